@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/ilyalavrinov/mtgbulkbuy/pkg/mtgbulk"
 	"go.uber.org/zap"
@@ -13,10 +19,18 @@ import (
 type handler struct {
 	loggerRaw *zap.Logger
 	logger    *zap.SugaredLogger
+
+	registry *mtgbulk.Registry
+	delivery *mtgbulk.DeliveryRules
+	sellers  *mtgbulk.SellerPolicy
+	// requestTimeout limits processing of every request if positive, the timeout parameter cannot exceed it
+	requestTimeout time.Duration
 }
 
 func newHandler() *handler {
-	h := &handler{}
+	h := &handler{
+		registry: mtgbulk.DefaultRegistry,
+	}
 	var err error
 
 	cfg := zap.NewDevelopmentConfig()
@@ -29,27 +43,126 @@ func newHandler() *handler {
 	return h
 }
 
+// incompleteHeader is set if some searches have failed or have been cut by the timeout and the result might miss offers
+const incompleteHeader = "X-Mtgbulk-Incomplete"
+
+// bulkResponse is sent instead of bare min prices if "details=true" is requested
+type bulkResponse struct {
+	MinPricesNoDelivery map[string][]mtgbulk.CardPrice
+	Incomplete          bool
+	Diagnostics         map[string][]mtgbulk.SearchDiagnostics
+	DeliveryPlan        *mtgbulk.PurchasePlan     `json:",omitempty"`
+	Plans               []*mtgbulk.PurchasePlan   `json:",omitempty"`
+	Unknown             []mtgbulk.UnknownCard     `json:",omitempty"`
+	Unavailable         []mtgbulk.UnavailableCard `json:",omitempty"`
+	Deferred            map[string]int            `json:",omitempty"`
+	Bills               []mtgbulk.Bill            `json:",omitempty"`
+	Issues              []mtgbulk.Issue           `json:",omitempty"`
+}
+
 func (h *handler) bulkHandler(resp http.ResponseWriter, req *http.Request) {
 	defer h.logger.Sync()
 	body := req.Body
 	defer body.Close()
 
-	contentType := req.Header["Content-Type"]
-	if len(contentType) != 1 || contentType[0] != "text/plain" {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/plain" && mediaType != "application/json") {
 		resp.WriteHeader(http.StatusBadRequest)
-		io.WriteString(resp, "Content-Type: text/plain is expected\n")
+		io.WriteString(resp, "Content-Type: text/plain or application/json is expected\n")
 		return
 	}
 
-	result, err := mtgbulk.ProcessText(body)
+	ctx := req.Context()
+	timeout := h.requestTimeout
+	if t := req.URL.Query().Get("timeout"); t != "" {
+		queryTimeout, err := time.ParseDuration(t)
+		if err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			io.WriteString(resp, "timeout is expected to be a duration like 30s\n")
+			return
+		}
+		if timeout <= 0 || queryTimeout < timeout {
+			timeout = queryTimeout
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if req.URL.Query().Get("refresh") == "true" {
+		ctx = mtgbulk.WithCacheRefresh(ctx)
+	}
+
+	var cards mtgbulk.NamesRequest
+	switch mediaType {
+	case "application/json":
+		cards, err = h.jsonRequest(body)
+	default:
+		cards, err = h.textRequest(body, req.URL.Query())
+	}
+	var validationErr *mtgbulk.ValidationError
+	if errors.As(err, &validationErr) {
+		resp.WriteHeader(http.StatusBadRequest)
+		for _, i := range validationErr.Issues {
+			io.WriteString(resp, i.String()+"\n")
+		}
+		return
+	}
 	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		io.WriteString(resp, err.Error()+"\n")
+		return
+	}
+
+	result, err := mtgbulk.ProcessByNamesContext(ctx, cards)
+	var optionsErr *mtgbulk.OptionsError
+	if errors.As(err, &optionsErr) {
+		resp.WriteHeader(http.StatusBadRequest)
+		io.WriteString(resp, err.Error()+"\n")
+		return
+	}
+	var limitErr *mtgbulk.SellerLimitError
+	var budgetErr *mtgbulk.BudgetError
+	if errors.As(err, &limitErr) || errors.As(err, &budgetErr) {
+		resp.WriteHeader(http.StatusUnprocessableEntity)
+		io.WriteString(resp, err.Error()+"\n")
+		return
+	}
+	// an interrupted search still has a result, it is sent as incomplete
+	interrupted := result != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled))
+	if err != nil && !interrupted {
 		resp.WriteHeader(http.StatusInternalServerError)
 		h.logger.Errorw("Handle Text error",
 			"err", err)
 		return
 	}
+	if interrupted {
+		h.logger.Warnw("Search interrupted, sending partial result",
+			"err", err)
+	}
+
+	var resData interface{} = result.MinPricesNoDelivery
+	if req.URL.Query().Get("details") == "true" {
+		resData = bulkResponse{
+			MinPricesNoDelivery: result.MinPricesNoDelivery,
+			Incomplete:          interrupted || result.Incomplete(),
+			Diagnostics:         result.Diagnostics,
+			DeliveryPlan:        result.DeliveryPlan,
+			Plans:               result.Plans,
+			Unknown:             result.Unknown,
+			Unavailable:         result.Unavailable,
+			Deferred:            result.Deferred,
+			Bills:               result.Bills,
+			Issues:              result.Issues,
+		}
+	}
+	if interrupted || result.Incomplete() {
+		resp.Header().Set(incompleteHeader, "true")
+	}
 
-	resBody, err := json.Marshal(result.MinPricesNoDelivery)
+	resBody, err := json.Marshal(resData)
 	if err != nil {
 		resp.WriteHeader(http.StatusInternalServerError)
 		h.logger.Errorw("Cannot write json with text search result",
@@ -60,3 +173,146 @@ func (h *handler) bulkHandler(resp http.ResponseWriter, req *http.Request) {
 	resp.WriteHeader(http.StatusOK)
 	resp.Write(resBody)
 }
+
+// textRequest reads a card list, options are taken from query parameters.
+func (h *handler) textRequest(body io.Reader, query url.Values) (mtgbulk.NamesRequest, error) {
+	format, err := mtgbulk.ParseDeckFormat(query.Get("format"))
+	if err != nil {
+		return mtgbulk.NamesRequest{}, err
+	}
+	mode, err := mtgbulk.ParseValidationMode(query.Get("validation"))
+	if err != nil {
+		return mtgbulk.NamesRequest{}, err
+	}
+	cards, err := mtgbulk.ParseDeck(body, format, mode)
+	if err != nil {
+		return cards, err
+	}
+	cards.Searchers = h.registry
+	cards.Delivery = h.delivery
+	cards.Sellers = h.sellers
+	if d := query.Get("delivery"); d != "" {
+		cards.DeliveryFee, err = strconv.Atoi(d)
+		if err != nil || cards.DeliveryFee < 0 {
+			return cards, fmt.Errorf("delivery is expected to be a non-negative integer")
+		}
+	}
+
+	cards.Strategy, err = mtgbulk.ParsePlanStrategy(query.Get("strategy"))
+	if err != nil {
+		return cards, err
+	}
+
+	if m := query.Get("max_sellers"); m != "" {
+		cards.MaxSellers, err = strconv.Atoi(m)
+		if err != nil || cards.MaxSellers < 0 {
+			return cards, fmt.Errorf("max_sellers is expected to be a non-negative integer")
+		}
+	}
+
+	if a := query.Get("alternatives"); a != "" {
+		cards.Alternatives, err = strconv.Atoi(a)
+		if err != nil || cards.Alternatives < 0 {
+			return cards, fmt.Errorf("alternatives is expected to be a non-negative integer")
+		}
+	}
+
+	if b := query.Get("budget"); b != "" {
+		budget, err := strconv.ParseFloat(b, 32)
+		if err != nil || budget < 0 {
+			return cards, fmt.Errorf("budget is expected to be a non-negative number")
+		}
+		cards.Budget = float32(budget)
+	}
+
+	cards.Split, err = mtgbulk.ParseSplitMode(query.Get("split"))
+	return cards, err
+}
+
+// bulkRequest is an application/json request. Delivery and sellers replace the ones of the server config if set,
+// platforms limit searches to the listed ones
+type bulkRequest struct {
+	Cards      []mtgbulk.RequestLine `json:"cards"`
+	Validation string                `json:"validation"`
+	Platforms  []string              `json:"platforms"`
+	Timeout    string                `json:"timeout"`
+
+	DeliveryFee  int                    `json:"delivery_fee"`
+	Delivery     *mtgbulk.DeliveryRules `json:"delivery"`
+	Sellers      *mtgbulk.SellerPolicy  `json:"sellers"`
+	Strategy     string                 `json:"strategy"`
+	PlanBudget   string                 `json:"plan_budget"`
+	MaxSellers   int                    `json:"max_sellers"`
+	Alternatives int                    `json:"alternatives"`
+	Budget       float32                `json:"budget"`
+	Split        string                 `json:"split"`
+}
+
+func (h *handler) jsonRequest(body io.Reader) (mtgbulk.NamesRequest, error) {
+	var br bulkRequest
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&br); err != nil {
+		return mtgbulk.NamesRequest{}, fmt.Errorf("could not decode request: %w", err)
+	}
+
+	mode, err := mtgbulk.ParseValidationMode(br.Validation)
+	if err != nil {
+		return mtgbulk.NamesRequest{}, err
+	}
+	cards, err := mtgbulk.ParseLines(br.Cards, mode)
+	if err != nil {
+		return cards, err
+	}
+
+	cards.Searchers = h.registry
+	if len(br.Platforms) > 0 {
+		cards.Searchers, err = h.registry.Only(br.Platforms)
+		if err != nil {
+			return cards, err
+		}
+	}
+	if br.Timeout != "" {
+		cards.Timeout, err = time.ParseDuration(br.Timeout)
+		if err != nil {
+			return cards, fmt.Errorf("timeout is expected to be a duration like 30s")
+		}
+	}
+
+	cards.Delivery = h.delivery
+	if br.Delivery != nil {
+		cards.Delivery = br.Delivery
+	}
+	cards.Sellers = h.sellers
+	if br.Sellers != nil {
+		cards.Sellers = br.Sellers
+	}
+	if br.DeliveryFee < 0 {
+		return cards, fmt.Errorf("delivery_fee is expected to be a non-negative integer")
+	}
+	cards.DeliveryFee = br.DeliveryFee
+	cards.Strategy, err = mtgbulk.ParsePlanStrategy(br.Strategy)
+	if err != nil {
+		return cards, err
+	}
+	if br.PlanBudget != "" {
+		cards.PlanBudget, err = time.ParseDuration(br.PlanBudget)
+		if err != nil || cards.PlanBudget < 0 {
+			return cards, fmt.Errorf("plan_budget is expected to be a duration like 5s")
+		}
+	}
+	if br.MaxSellers < 0 {
+		return cards, fmt.Errorf("max_sellers is expected to be a non-negative integer")
+	}
+	cards.MaxSellers = br.MaxSellers
+	if br.Alternatives < 0 {
+		return cards, fmt.Errorf("alternatives is expected to be a non-negative integer")
+	}
+	cards.Alternatives = br.Alternatives
+	if br.Budget < 0 {
+		return cards, fmt.Errorf("budget is expected to be a non-negative number")
+	}
+	cards.Budget = br.Budget
+	cards.Split, err = mtgbulk.ParseSplitMode(br.Split)
+	return cards, err
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ilyalavrinov/mtgbulkbuy/pkg/mtgbulk"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	lib, err := mtgbulk.NewInMemoryLibrary(filepath.Join("..", "..", "pkg", "mtgbulk", "testdata", "library.json"))
+	if err != nil {
+		panic(err)
+	}
+	mtgbulk.SetLibrary(lib)
+	os.Exit(m.Run())
+}
+
+// testSearcher finds a single offer of every card, or nothing until ctx is done if blocked
+type testSearcher struct {
+	name    string
+	blocked bool
+
+	mu       sync.Mutex
+	searches int
+}
+
+func (s *testSearcher) Name() string                   { return s.name }
+func (s *testSearcher) Platform() mtgbulk.PlatformType { return mtgbulk.MtgSale }
+func (s *testSearcher) Search(ctx context.Context, q mtgbulk.SearchQuery) (mtgbulk.CardResult, error) {
+	s.mu.Lock()
+	s.searches++
+	s.mu.Unlock()
+	if s.blocked {
+		<-ctx.Done()
+		return mtgbulk.CardResult{}, ctx.Err()
+	}
+	return mtgbulk.CardResult{
+		Available: true,
+		Prices:    []mtgbulk.CardPrice{{Platform: mtgbulk.MtgSale, Trader: s.name, Price: 10, Quantity: 4}},
+	}, nil
+}
+
+func (s *testSearcher) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.searches
+}
+
+func newTestHandler(t *testing.T, searchers ...*testSearcher) *handler {
+	registry := mtgbulk.NewRegistry()
+	for _, s := range searchers {
+		if err := registry.Register(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := zap.NewNop()
+	return &handler{
+		loggerRaw: logger,
+		logger:    logger.Sugar(),
+		registry:  registry,
+	}
+}
+
+// postJSON sends body to the /bulk handler of h with the query
+func postJSON(h *handler, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/bulk?"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	h.bulkHandler(resp, req)
+	return resp
+}
+
+func TestBulkJSONRejectsUnknownFields(t *testing.T) {
+	shop := &testSearcher{name: "shop"}
+	h := newTestHandler(t, shop)
+	resp := postJSON(h, "", `{"cards": [{"name": "Lightning Bolt"}], "platform": ["shop"]}`)
+	if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), `unknown field "platform"`) {
+		t.Errorf("the unknown field is expected to be rejected, got %d %q", resp.Code, resp.Body.String())
+	}
+	resp = postJSON(h, "", `{"cards": [{"name": "Lightning Bolt", "count": 2}]}`)
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("the unknown field of a line is expected to be rejected, got %d %q", resp.Code, resp.Body.String())
+	}
+	if n := shop.count(); n != 0 {
+		t.Errorf("rejected requests are not expected to be searched, got %d searches", n)
+	}
+}
+
+func TestBulkJSONPlatforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		platforms string
+		code      int
+		// searched are searchers expected to search, disabled ones are never searched
+		searched []bool
+	}{
+		{"all enabled", `[]`, http.StatusOK, []bool{true, true, false}},
+		{"one", `["a"]`, http.StatusOK, []bool{true, false, false}},
+		{"disabled", `["a", "c"]`, http.StatusBadRequest, []bool{false, false, false}},
+		{"unknown", `["d"]`, http.StatusBadRequest, []bool{false, false, false}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			searchers := []*testSearcher{{name: "a"}, {name: "b"}, {name: "c"}}
+			h := newTestHandler(t, searchers...)
+			if err := h.registry.Disable("c"); err != nil {
+				t.Fatal(err)
+			}
+			resp := postJSON(h, "", `{"cards": [{"name": "Lightning Bolt"}], "platforms": `+tc.platforms+`}`)
+			if resp.Code != tc.code {
+				t.Fatalf("status %d is expected, got %d %q", tc.code, resp.Code, resp.Body.String())
+			}
+			for i, s := range searchers {
+				if searched := s.count() > 0; searched != tc.searched[i] {
+					t.Errorf("%s: searched %v is expected", s.name, tc.searched[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBulkJSONTimeoutWithinServerTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverTimeout time.Duration
+		timeout       string
+	}{
+		{"request is shorter", 10 * time.Second, "100ms"},
+		{"server is shorter", 100 * time.Millisecond, "10s"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHandler(t, &testSearcher{name: "fast"}, &testSearcher{name: "slow", blocked: true})
+			h.requestTimeout = tc.serverTimeout
+
+			start := time.Now()
+			resp := postJSON(h, "details=true", `{"cards": [{"name": "Lightning Bolt", "quantity": 2}], "timeout": "`+tc.timeout+`"}`)
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("the shorter timeout is expected to stop the search, it took %s", elapsed)
+			}
+			if resp.Code != http.StatusOK || resp.Header().Get(incompleteHeader) != "true" {
+				t.Fatalf("an incomplete result is expected, got %d %q", resp.Code, resp.Body.String())
+			}
+			var res bulkResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if !res.Incomplete || len(res.MinPricesNoDelivery["Lightning Bolt"]) == 0 {
+				t.Errorf("offers of the fast searcher are expected in an incomplete result, got %+v", res)
+			}
+		})
+	}
+
+	h := newTestHandler(t, &testSearcher{name: "fast"})
+	if resp := postJSON(h, "", `{"cards": [{"name": "Lightning Bolt"}], "timeout": "soon"}`); resp.Code != http.StatusBadRequest {
+		t.Errorf("a timeout which is not a duration is expected to be rejected, got %d", resp.Code)
+	}
+}
+
+func TestBulkJSONIssuesReferToLines(t *testing.T) {
+	body := `{"cards": [{"name": "Lightning Bolt"}, {"name": ""}, {"name": "Shock", "quantity": -1}]%s}`
+
+	resp := postJSON(newTestHandler(t, &testSearcher{name: "shop"}), "", strings.Replace(body, "%s", "", 1))
+	want := "line 2: error: empty cardname\nline 3: error: illegal quantity for card \"Shock\" has been requested: -1\n"
+	if resp.Code != http.StatusBadRequest || resp.Body.String() != want {
+		t.Errorf("issues of lines 2 and 3 are expected in strict mode, got %d %q", resp.Code, resp.Body.String())
+	}
+
+	resp = postJSON(newTestHandler(t, &testSearcher{name: "shop"}), "details=true", strings.Replace(body, "%s", `, "validation": "lenient"`, 1))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("lenient mode is expected to skip bad lines, got %d %q", resp.Code, resp.Body.String())
+	}
+	var res bulkResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	var lines []int
+	for _, i := range res.Issues {
+		lines = append(lines, i.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 3}) {
+		t.Errorf("issues of lines 2 and 3 are expected, got %+v", res.Issues)
+	}
+	if len(res.MinPricesNoDelivery["Lightning Bolt"]) == 0 {
+		t.Errorf("the valid line is expected to be searched, got %+v", res.MinPricesNoDelivery)
+	}
+}
+
+func TestBulkJSONRejectsInvalidOptions(t *testing.T) {
+	shop := &testSearcher{name: "shop"}
+	h := newTestHandler(t, shop)
+	for _, body := range []string{
+		`{"cards": [{"name": "Lightning Bolt"}], "sellers": {"preferences": {"a@MtgSale": {"multiplier": -1}}}}`,
+		`{"cards": [{"name": "Lightning Bolt"}], "sellers": {"preferences": {"a@MtgSale": {}, "A@mtgsale": {}}}}`,
+	} {
+		if resp := postJSON(h, "", body); resp.Code != http.StatusBadRequest {
+			t.Errorf("%s: status 400 is expected, got %d %q", body, resp.Code, resp.Body.String())
+		}
+	}
+	if n := shop.count(); n != 0 {
+		t.Errorf("rejected requests are not expected to be searched, got %d searches", n)
+	}
+}
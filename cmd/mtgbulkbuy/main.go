@@ -1,16 +1,69 @@
 package main
 
 import (
+	"flag"
 	"net/http"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/ilyalavrinov/mtgbulkbuy/pkg/mtgbulk"
 )
 
+var cacheDir = flag.String("cache-dir", "", "directory with cached search results (default is a per-user cache dir)")
+var cacheTTL = flag.Duration("cache-ttl", time.Hour, "how long cached search results are used (0 disables cache)")
+var configPath = flag.String("config", "", "JSON file with platforms configuration (base URLs, disabled platforms)")
+var requestTimeout = flag.Duration("request-timeout", 3*time.Minute, "max processing time of a request, the partial result is sent when it expires")
+
+// writeMargin is left after the request timeout to write the result
+const writeMargin = 15 * time.Second
+
 func main() {
+	flag.Parse()
+
 	router := mux.NewRouter()
 	h := newHandler()
 	defer h.loggerRaw.Sync()
+	h.requestTimeout = *requestTimeout
+
+	var cfg mtgbulk.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = mtgbulk.LoadConfig(*configPath)
+		if err != nil {
+			h.logger.Fatalw("config load failed",
+				"err", err)
+		}
+		h.delivery = cfg.Delivery
+		h.sellers = cfg.Sellers
+		h.registry, err = mtgbulk.NewConfiguredRegistry(cfg)
+		if err != nil {
+			h.logger.Fatalw("config apply failed",
+				"err", err)
+		}
+	}
+
+	// DefaultRegistry is shared by the whole process, middleware of the server must not leak into it
+	h.registry = h.registry.Clone()
+	// teammates often look up the same cards at the same time
+	h.registry.Use(mtgbulk.NewCoalescer().Middleware())
+	// cached results would neither be recorded nor be taken from the recorded snapshot
+	if *cacheTTL > 0 && cfg.HTTPMode == mtgbulk.HTTPModeLive {
+		dir := *cacheDir
+		if dir == "" {
+			var err error
+			dir, err = mtgbulk.DefaultCacheDir()
+			if err != nil {
+				h.logger.Fatalw("cannot get default cache dir",
+					"err", err)
+			}
+		}
+		cache, err := mtgbulk.NewDiskCache(dir, *cacheTTL)
+		if err != nil {
+			h.logger.Fatalw("cache init failed",
+				"err", err)
+		}
+		h.registry.Use(cache.Middleware())
+	}
 
 	h.logger.Debug("Registering handlers")
 	router.HandleFunc("/bulk", h.bulkHandler)
@@ -19,7 +72,7 @@ func main() {
 	srv := &http.Server{
 		Handler:      router,
 		Addr:         "127.0.0.1:8000",
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: *requestTimeout + writeMargin,
 		ReadTimeout:  15 * time.Second,
 	}
 
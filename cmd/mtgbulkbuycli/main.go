@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/ilyalavrinov/mtgbulkbuy/pkg/mtgbulk"
 	"github.com/jedib0t/go-pretty/table"
@@ -17,6 +22,25 @@ const (
 )
 
 var filename = flag.String(filenameArg, "", filenameUsage)
+var concurrency = flag.Int("concurrency", mtgbulk.DefaultConcurrency, "max number of searches running at once")
+var domainConcurrency = flag.Int("domain-concurrency", mtgbulk.DefaultDomainConcurrency, "max number of searches running at once against a single shop")
+var timeout = flag.Duration("timeout", 0, "stop searching after this time and show partial results (0 means no limit)")
+var cacheDir = flag.String("cache-dir", "", "directory with cached search results (default is a per-user cache dir)")
+var cacheTTL = flag.Duration("cache-ttl", time.Hour, "how long cached search results are used (0 disables cache)")
+var refresh = flag.Bool("refresh", false, "ignore cached search results and search again")
+var configPath = flag.String("config", "", "JSON file with platforms configuration (base URLs, disabled platforms)")
+var recordDir = flag.String("record", "", "record all HTTP exchanges to this directory")
+var replayDir = flag.String("replay", "", "serve HTTP exchanges recorded earlier from this directory instead of the network")
+var strategy = flag.String("strategy", "", "how the delivery-aware plan is searched for: exact, heuristic or empty for automatic choice")
+var planBudget = flag.Duration("plan-budget", mtgbulk.DefaultPlanBudget, "max time spent on the delivery-aware plan")
+var maxSellers = flag.Int("max-sellers", 0, "max number of sellers (packages) in the delivery-aware plan, 0 means no limit")
+var alternatives = flag.Int("alternatives", 0, "number of delivery-aware plans with different sellers to show")
+var budget = flag.Float64("budget", 0, "max money to spend, delivery included; cards are chosen by priorities written as [must], [nice] or [weight] after names (0 means no limit)")
+var split = flag.String("split", "", "how delivery is shared in bills of a group buy with lines tagged as @owner: proportional or equal")
+var format = flag.String("format", "", "format of the list: text, arena, mtgo, csv or empty to detect it")
+var validation = flag.String("validation", "", "what to do with bad lines of the list: strict rejects the list, lenient skips them")
+var havePath = flag.String("have", "", "file with owned cards (text list or CSV with name and count columns), owned copies are not bought")
+var deliveryFee = flag.Int("delivery", 0, "delivery fee charged by every seller, overrides the default one of the config; enables delivery-aware plan if positive")
 
 func main() {
 	flag.Parse()
@@ -32,37 +56,228 @@ func main() {
 		os.Exit(1)
 	}
 
-	result, err := mtgbulk.ProcessText(f)
+	deckFormat, err := mtgbulk.ParseDeckFormat(*format)
 	if err != nil {
-		fmt.Printf("could not get result; error: %s", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	mode, err := mtgbulk.ParseValidationMode(*validation)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	req, err := mtgbulk.ParseDeck(f, deckFormat, mode)
+	var validationErr *mtgbulk.ValidationError
+	if errors.As(err, &validationErr) {
+		fmt.Printf("could not parse file %q:\n", *filename)
+		for _, i := range validationErr.Issues {
+			fmt.Println(i)
+		}
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("could not parse file %q; error: %s", *filename, err)
+		os.Exit(1)
+	}
+	for _, i := range req.Issues {
+		fmt.Println(i)
+	}
+	req.Concurrency = *concurrency
+	req.DomainConcurrency = *domainConcurrency
+	req.Timeout = *timeout
+	req.DeliveryFee = *deliveryFee
+	req.PlanBudget = *planBudget
+	req.MaxSellers = *maxSellers
+	req.Alternatives = *alternatives
+	req.Budget = float32(*budget)
+	req.Strategy, err = mtgbulk.ParsePlanStrategy(*strategy)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	req.Split, err = mtgbulk.ParseSplitMode(*split)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *havePath != "" {
+		fh, err := os.Open(*havePath)
+		if err != nil {
+			fmt.Printf("could not open file %q; error: %s", *havePath, err)
+			os.Exit(1)
+		}
+		req.Inventory, err = mtgbulk.ParseInventory(fh)
+		fh.Close()
+		if err != nil {
+			fmt.Printf("could not parse file %q; error: %s", *havePath, err)
+			os.Exit(1)
+		}
+	}
+
+	var cfg mtgbulk.Config
+	if *configPath != "" {
+		cfg, err = mtgbulk.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("could not load config; error: %s", err)
+			os.Exit(1)
+		}
+		req.Delivery = cfg.Delivery
+		req.Sellers = cfg.Sellers
+	}
+	if *recordDir != "" && *replayDir != "" {
+		fmt.Println("only one of record and replay can be used at once")
+		os.Exit(1)
+	}
+	if *recordDir != "" {
+		cfg.HTTPMode = mtgbulk.HTTPModeRecord
+		cfg.FixturesDir = *recordDir
+	}
+	if *replayDir != "" {
+		cfg.HTTPMode = mtgbulk.HTTPModeReplay
+		cfg.FixturesDir = *replayDir
+	}
+	registry, err := mtgbulk.NewConfiguredRegistry(cfg)
+	if err != nil {
+		fmt.Printf("could not apply config; error: %s", err)
+		os.Exit(1)
+	}
+	req.Searchers = registry
+
+	// cached results would neither be recorded nor be taken from the recorded snapshot
+	if *cacheTTL > 0 && cfg.HTTPMode == mtgbulk.HTTPModeLive {
+		cache, err := newCache(*cacheDir, *cacheTTL)
+		if err != nil {
+			fmt.Printf("could not init cache; error: %s", err)
+			os.Exit(1)
+		}
+		registry.Use(cache.Middleware())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if *refresh {
+		ctx = mtgbulk.WithCacheRefresh(ctx)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		fmt.Println("interrupted, finishing with partial results")
+		cancel()
+	}()
+
+	result, err := mtgbulk.ProcessByNamesContext(ctx, req)
+	var limitErr *mtgbulk.SellerLimitError
+	var budgetErr *mtgbulk.BudgetError
+	if err != nil {
+		switch {
+		case result != nil && (errors.As(err, &limitErr) || errors.As(err, &budgetErr)):
+			fmt.Printf("no delivery-aware plan; error: %s\n", err)
+		case result != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)):
+			fmt.Printf("results are incomplete; error: %s\n", err)
+		default:
+			fmt.Printf("could not get result; error: %s", err)
+			os.Exit(1)
+		}
+	}
 
 	for name, cards := range result.AllSortedCards {
 		fmt.Printf("%s ==> total found %d\n", name, len(cards.Prices))
 	}
 
+	for _, name := range result.Covered {
+		fmt.Printf("card %q is covered by the collection\n", name)
+	}
+	owned := make([]string, 0, len(result.FromInventory))
+	for name := range result.FromInventory {
+		owned = append(owned, name)
+	}
+	sort.Strings(owned)
+	for _, name := range owned {
+		if n := result.FromInventory[name]; req.Cards[name] > n {
+			fmt.Printf("%d of %d copies of %q are taken from the collection\n", n, req.Cards[name], name)
+		}
+	}
+	for _, card := range result.Unknown {
+		fmt.Printf("unknown card %q", card.Name)
+		if len(card.Suggestions) > 0 {
+			fmt.Printf(", did you mean %s?", strings.Join(card.Suggestions, ", "))
+		}
+		fmt.Println()
+	}
+	for _, card := range result.Unavailable {
+		fmt.Printf("card %q is not available: %d of %d copies missing\n", card.Name, card.Missing, card.Requested)
+	}
+
+	if result.Incomplete() {
+		fmt.Println("Some searches are incomplete, results might miss offers:")
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"Cardname", "Platform", "Status", "HTTP", "Parsed", "Skipped", "Error"})
+		rows := make([]table.Row, 0)
+		for name, diags := range result.Diagnostics {
+			for _, d := range diags {
+				if d.Complete() {
+					continue
+				}
+				rows = append(rows, table.Row{name, d.Platform, d.Status, d.HTTPCode, d.RowsParsed, d.RowsSkipped, d.Error})
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i][0].(string) < rows[j][0].(string)
+		})
+		t.AppendRows(rows)
+		t.Render()
+	}
+
 	if len(result.MinPricesNoDelivery) > 0 {
 		fmt.Println("Min price rule:")
 		var total float32
 		t := table.NewWriter()
 		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Cardname", "Qty", "Price", "Seller"})
+		t.AppendHeader(table.Row{"Cardname", "Qty", "Price", "Seller", "Edition"})
 		rows := make([]table.Row, 0)
 		for name, prices := range result.MinPricesNoDelivery {
 			for _, p := range prices {
-				rows = append(rows, table.Row{name, p.Quantity, p.Price, p.SellerFullName()})
-				total += p.Price
+				rows = append(rows, table.Row{name, p.Quantity, p.Price, p.SellerFullName(), p.Edition})
+				total += p.Price * float32(p.Quantity)
 			}
 		}
 		sort.Slice(rows, func(i, j int) bool {
 			return rows[i][0].(string) < rows[j][0].(string)
 		})
 		t.AppendRows(rows)
-		t.AppendFooter(table.Row{"", "", "Total", total})
+		t.AppendFooter(table.Row{"", "", "Total", total, ""})
 		t.Render()
+		printDeferred(result.Deferred)
 	}
 
+	if result.DeliveryPlan != nil {
+		fmt.Println("Min price with delivery rule:")
+		printPlan(result.DeliveryPlan)
+	}
+	if len(result.Plans) > 1 {
+		fmt.Println("Alternative plans:")
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.AppendHeader(table.Row{"#", "Sellers", "Cards", "Delivery", "Total"})
+		for i, plan := range result.Plans {
+			names := make([]string, 0, len(plan.Sellers))
+			for _, order := range plan.Sellers {
+				names = append(names, order.Seller)
+			}
+			t.AppendRow(table.Row{i + 1, strings.Join(names, ", "), plan.CardsTotal, plan.DeliveryTotal, plan.Total})
+		}
+		t.Render()
+	}
+	if len(result.Bills) > 0 {
+		fmt.Println("Bills:")
+		printBills(result.Bills)
+	}
+
+	if result.MinPricesMatrix == nil {
+		return
+	}
 	res := *filename + ".matrix.out"
 	os.Remove(res)
 	f, err = os.Create(res)
@@ -85,6 +300,66 @@ func main() {
 	}
 }
 
+func printPlan(plan *mtgbulk.PurchasePlan) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Seller", "Cardname", "Qty", "Price"})
+	for _, order := range plan.Sellers {
+		for _, item := range order.Items {
+			t.AppendRow(table.Row{order.Seller, item.Card, item.Quantity, item.Price})
+		}
+		t.AppendRow(table.Row{order.Seller, "(delivery)", "", order.Delivery})
+	}
+	t.AppendFooter(table.Row{"", "Cards", "", plan.CardsTotal})
+	t.AppendFooter(table.Row{"", "Delivery", "", plan.DeliveryTotal})
+	t.AppendFooter(table.Row{"", "Total", "", plan.Total})
+	t.Render()
+	printDeferred(plan.Deferred)
+	if !plan.Optimal {
+		fmt.Printf("%s search has not proven the plan to be the cheapest, no plan is cheaper than %.2f\n", plan.Strategy, plan.LowerBound)
+	}
+}
+
+func printBills(bills []mtgbulk.Bill) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.AppendHeader(table.Row{"Owner", "Cardname", "Qty", "Price", "Seller"})
+	for _, b := range bills {
+		owner := b.Owner
+		if owner == mtgbulk.Unassigned {
+			owner = "(nobody)"
+		}
+		for _, item := range b.Items {
+			t.AppendRow(table.Row{owner, item.Card, item.Quantity, item.Price, item.SellerFullName()})
+		}
+		t.AppendRow(table.Row{owner, "(delivery)", "", b.Delivery, ""})
+		t.AppendRow(table.Row{owner, "(total)", "", b.Total, ""})
+	}
+	t.Render()
+}
+
+func printDeferred(deferred map[string]int) {
+	names := make([]string, 0, len(deferred))
+	for name := range deferred {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("left out to fit the budget: %d %s\n", deferred[name], name)
+	}
+}
+
+func newCache(dir string, ttl time.Duration) (*mtgbulk.DiskCache, error) {
+	if dir == "" {
+		var err error
+		dir, err = mtgbulk.DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mtgbulk.NewDiskCache(dir, ttl)
+}
+
 func writeToXlsx(baseName string, res *mtgbulk.NamesResult, t *mtgbulk.PossessionTable) error {
 
 	minPrices := make(map[string]int, len(res.MinPricesNoDelivery))
@@ -101,6 +376,16 @@ func writeToXlsx(baseName string, res *mtgbulk.NamesResult, t *mtgbulk.Possessio
 	if err != nil {
 		return err
 	}
+	if len(res.Bills) > 0 {
+		sh, err = xls.AddSheet("bills")
+		if err != nil {
+			return err
+		}
+		err = mtgbulk.BillsToXlsxSheet(sh, res.Bills)
+		if err != nil {
+			return err
+		}
+	}
 
 	xlsname := *filename + ".xlsx"
 	os.Remove(xlsname)
@@ -1,74 +1,104 @@
 package mtgbulk
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gocolly/colly"
 )
 
-func searchAutumnsMagic(searchName string, names map[string]bool) CardResult {
+const autumnsMagicBaseURL = "https://autumnsmagic.com"
+
+type autumnsMagicSearcher struct {
+	platformSearcher
+}
+
+func NewAutumnsMagicSearcher(opts SearcherOptions) Searcher {
+	return &autumnsMagicSearcher{
+		platformSearcher: newPlatformSearcher(AutumnsMagic, autumnsMagicBaseURL, opts),
+	}
+}
+
+func (s *autumnsMagicSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q.EnglishName, q.Aliases)
+}
+
+func (s *autumnsMagicSearcher) search(ctx context.Context, searchName string, names map[string]bool) (CardResult, error) {
 	searchName = strings.ToLower(searchName)
 	result := newCardResult()
-	addr := autumnsMagickSearchURL(searchName)
+	addr := autumnsMagickSearchURL(s.baseURL, searchName)
 
-	c := colly.NewCollector()
-	c.SetRequestTimeout(20 * time.Second)
+	c := newCollector(ctx, s.transport)
+	diag := newSearchDiagnostics(AutumnsMagic.String())
+	diag.trackResponses(c)
 	c.OnHTML(".product-wrapper", func(e *colly.HTMLElement) {
-		name := e.ChildText(".card-name a")
-		if !names[strings.ToLower(name)] {
-			logger.Debugw("skipping",
-				"name", name)
-			return
-		}
-
-		qtyStr := e.ChildText(".product-description span")
-		qtyStr = strings.ReplaceAll(qtyStr, " шт.", "")
-		qty, err := strconv.Atoi(qtyStr)
+		price, matched, err := parseAutumnsMagicItem(e, names)
 		if err != nil {
-			logger.Errorw("card qty convert failed",
+			logger.Errorw("autumnsmagic item cannot be parsed",
+				"searchName", searchName,
 				"err", err)
+			diag.RowsSkipped++
 			return
 		}
-		priceStr := e.ChildText(".product-price span.product-default-price")
-		priceStr = strings.TrimSpace(priceStr)
-		priceStr = strings.ReplaceAll(priceStr, " руб.", "")
-		price, err := strconv.Atoi(priceStr)
-		if err != nil {
-			logger.Errorw("card price convert failed",
-				"err", err)
+		if !matched {
 			return
 		}
+
 		logger.Debugw("card",
 			"searchName", searchName,
-			"name", name,
-			"price", price,
-			"count", qty)
+			"price", price.Price,
+			"count", price.Quantity)
 
+		diag.RowsParsed++
+		price.URL = addr // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
 		result.Available = true
-		result.Prices = append(result.Prices, CardPrice{
-			Price:    float32(price),
-			Foil:     false, // TODO: get this info
-			Currency: RUR,
-			Quantity: qty,
-			Platform: MtgTrade,
-			Trader:   "AutumnsMagic",
-			URL:      addr, // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
-		})
+		result.Prices = append(result.Prices, price)
 	})
 
 	err := c.Visit(addr)
-	if err != nil {
-		logger.Errorw("Unable to visit with scraper",
-			"url", addr,
-			"err", err)
-	}
-	return result
+	return finishSearch(ctx, result, diag, addr, err)
 }
 
-func autumnsMagickSearchURL(searchName string) string {
+func autumnsMagickSearchURL(baseURL, searchName string) string {
 	searchName = strings.ReplaceAll(searchName, " ", "+")
-	return fmt.Sprintf("https://autumnsmagic.com/catalog?search=%s", searchName)
+	return fmt.Sprintf("%s/catalog?search=%s", baseURL, searchName)
+}
+
+// parseAutumnsMagicItem parses a single product. matched is false if the product is another card.
+func parseAutumnsMagicItem(e *colly.HTMLElement, names map[string]bool) (price CardPrice, matched bool, err error) {
+	name := e.ChildText(".card-name a")
+	if !names[strings.ToLower(name)] {
+		logger.Debugw("skipping",
+			"name", name)
+		return price, false, nil
+	}
+
+	qtyStr := e.ChildText(".product-description span")
+	// the description is the edition followed by the stock
+	edition := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(e.ChildText(".product-description")), qtyStr))
+	qtyStr = strings.ReplaceAll(qtyStr, " шт.", "")
+	qty, err := strconv.Atoi(qtyStr)
+	if err != nil {
+		return price, true, fmt.Errorf("card qty convert failed: %w", err)
+	}
+	priceStr := e.ChildText(".product-price span.product-default-price")
+	priceStr = strings.TrimSpace(priceStr)
+	priceStr = strings.ReplaceAll(priceStr, " руб.", "")
+	pVal, err := strconv.Atoi(priceStr)
+	if err != nil {
+		return price, true, fmt.Errorf("card price convert failed: %w", err)
+	}
+
+	return CardPrice{
+		Price:       float32(pVal),
+		FoilUnknown: true, // products do not tell foil copies apart
+		Currency:    RUR,
+		Quantity:    qty,
+		Edition:     edition,
+		Language:    nameLanguage(name), // guessed by the script of the title
+		Platform:    AutumnsMagic,
+		Trader:      "AutumnsMagic",
+	}, true, nil
 }
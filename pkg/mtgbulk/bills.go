@@ -0,0 +1,223 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tealeg/xlsx"
+)
+
+// SplitMode tells how delivery of a seller is shared between members of a group buy.
+type SplitMode string
+
+const (
+	// SplitProportional shares delivery in proportion to what everyone bought from the seller
+	SplitProportional SplitMode = ""
+	// SplitEqual shares delivery equally between everyone who bought from the seller
+	SplitEqual SplitMode = "equal"
+)
+
+// ParseSplitMode accepts "proportional", "equal" or an empty string for SplitProportional.
+func ParseSplitMode(s string) (SplitMode, error) {
+	if s == "proportional" {
+		return SplitProportional, nil
+	}
+	mode := SplitMode(s)
+	return mode, mode.validate()
+}
+
+func (m SplitMode) validate() error {
+	switch m {
+	case SplitProportional, SplitEqual:
+		return nil
+	}
+	return fmt.Errorf("unknown split mode %q", m)
+}
+
+// Unassigned is the owner of the bill with copies of lines which have no owner.
+const Unassigned = ""
+
+// Bill is what a member of a group buy pays.
+type Bill struct {
+	// Owner is Unassigned for copies nobody has claimed
+	Owner    string
+	Items    []PlanItem
+	Cards    float32
+	Delivery float32
+	Total    float32
+}
+
+type billUnit struct {
+	seller int
+	offer  CardPrice
+}
+
+// splitBills hands copies bought in orders over to their owners and shares delivery between them.
+// owners is card name -> owner -> copies. Copies of a card go round-robin, owners sorted by name,
+// the cheapest first, so nobody gets all the cheap ones. An owner gets nothing above the requested count,
+// copies left are billed to Unassigned, so the bills add up to the orders.
+func splitBills(owners map[string]map[string]int, orders []SellerOrder, mode SplitMode) []Bill {
+	units := make(map[string][]billUnit)
+	for si, order := range orders {
+		for _, item := range order.Items {
+			for i := 0; i < item.Quantity; i++ {
+				units[item.Card] = append(units[item.Card], billUnit{seller: si, offer: item.CardPrice})
+			}
+		}
+	}
+
+	bills := make(map[string]*Bill)
+	bill := func(owner string) *Bill {
+		b, found := bills[owner]
+		if !found {
+			b = &Bill{Owner: owner}
+			bills[owner] = b
+		}
+		return b
+	}
+	// sellerShares is seller -> owner -> subtotal
+	sellerShares := make([]map[string]float32, len(orders))
+	for si := range sellerShares {
+		sellerShares[si] = make(map[string]float32)
+	}
+
+	cards := make([]string, 0, len(units))
+	for card := range units {
+		cards = append(cards, card)
+	}
+	for card := range owners {
+		if _, found := units[card]; !found {
+			cards = append(cards, card)
+		}
+	}
+	sort.Strings(cards)
+	for _, card := range cards {
+		names := make([]string, 0, len(owners[card]))
+		left := make(map[string]int, len(owners[card]))
+		for owner, n := range owners[card] {
+			names = append(names, owner)
+			left[owner] = n
+			bill(owner)
+		}
+		sort.Strings(names)
+
+		cardUnits := units[card]
+		sort.SliceStable(cardUnits, func(i, j int) bool {
+			return cardUnits[i].offer.Price < cardUnits[j].offer.Price
+		})
+		next := 0
+		for _, u := range cardUnits {
+			owner := Unassigned
+			for i := 0; i < len(names); i++ {
+				candidate := names[(next+i)%len(names)]
+				if left[candidate] > 0 {
+					owner = candidate
+					next = (next + i + 1) % len(names)
+					break
+				}
+			}
+			if owner != Unassigned {
+				left[owner]--
+			}
+
+			b := bill(owner)
+			if n := len(b.Items); n > 0 && b.Items[n-1].Card == card && b.Items[n-1].SellerFullName() == u.offer.SellerFullName() && b.Items[n-1].Price == u.offer.Price {
+				b.Items[n-1].Quantity++
+			} else {
+				item := PlanItem{Card: card, CardPrice: u.offer}
+				item.Quantity = 1
+				b.Items = append(b.Items, item)
+			}
+			b.Cards += u.offer.Price
+			sellerShares[u.seller][owner] += u.offer.Price
+		}
+	}
+
+	for si, order := range orders {
+		shares := sellerShares[si]
+		if order.Delivery == 0 || len(shares) == 0 {
+			continue
+		}
+		var subtotal float32
+		for _, s := range shares {
+			subtotal += s
+		}
+		for owner, s := range shares {
+			if mode == SplitEqual || subtotal == 0 {
+				bill(owner).Delivery += order.Delivery / float32(len(shares))
+			} else {
+				bill(owner).Delivery += order.Delivery * s / subtotal
+			}
+		}
+	}
+
+	result := make([]Bill, 0, len(bills))
+	for _, b := range bills {
+		b.Total = b.Cards + b.Delivery
+		result = append(result, *b)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Owner < result[j].Owner
+	})
+	return result
+}
+
+// ordersFromMinPrices turns greedy min prices into orders without delivery, so they can be split into bills.
+func ordersFromMinPrices(minPrices map[string][]CardPrice) []SellerOrder {
+	bySeller := make(map[string]*SellerOrder)
+	var sellers []string
+	for card, prices := range minPrices {
+		for _, cp := range prices {
+			seller := cp.SellerFullName()
+			order, found := bySeller[seller]
+			if !found {
+				order = &SellerOrder{Seller: seller}
+				bySeller[seller] = order
+				sellers = append(sellers, seller)
+			}
+			order.Items = append(order.Items, PlanItem{Card: card, CardPrice: cp})
+			order.Subtotal += cp.Price * float32(cp.Quantity)
+		}
+	}
+	sort.Strings(sellers)
+	orders := make([]SellerOrder, 0, len(sellers))
+	for _, seller := range sellers {
+		order := bySeller[seller]
+		order.Total = order.Subtotal
+		orders = append(orders, *order)
+	}
+	return orders
+}
+
+// BillsToXlsxSheet writes every item of every bill as a row followed by the totals of the owner.
+func BillsToXlsxSheet(out *xlsx.Sheet, bills []Bill) error {
+	header := out.AddRow()
+	for _, title := range []string{"Owner", "Cardname", "Qty", "Price", "Seller"} {
+		header.AddCell().SetString(title)
+	}
+	for _, b := range bills {
+		owner := b.Owner
+		if owner == Unassigned {
+			owner = "(nobody)"
+		}
+		for _, item := range b.Items {
+			row := out.AddRow()
+			row.AddCell().SetString(owner)
+			row.AddCell().SetString(item.Card)
+			row.AddCell().SetInt(item.Quantity)
+			row.AddCell().SetFloat(float64(item.Price))
+			row.AddCell().SetString(item.SellerFullName())
+		}
+		for _, total := range []struct {
+			name  string
+			value float32
+		}{{"Cards", b.Cards}, {"Delivery", b.Delivery}, {"Total", b.Total}} {
+			row := out.AddRow()
+			row.AddCell().SetString(owner)
+			row.AddCell().SetString(total.name)
+			row.AddCell()
+			row.AddCell().SetFloat(float64(total.value))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package mtgbulk
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testOrder(seller string, delivery float32, items ...PlanItem) SellerOrder {
+	o := SellerOrder{Seller: testSeller(seller), Items: items, Delivery: delivery}
+	for i := range o.Items {
+		o.Items[i].Platform = MtgTrade
+		o.Items[i].Trader = seller
+		o.Subtotal += o.Items[i].Price * float32(o.Items[i].Quantity)
+	}
+	o.Total = o.Subtotal + o.Delivery
+	return o
+}
+
+func testItem(card string, price float32, quantity int) PlanItem {
+	return PlanItem{Card: card, CardPrice: CardPrice{Price: price, Quantity: quantity}}
+}
+
+// billPrices lists prices of copies in the bill of every owner
+func billPrices(bills []Bill) map[string][]float32 {
+	result := make(map[string][]float32)
+	for _, b := range bills {
+		for _, item := range b.Items {
+			for i := 0; i < item.Quantity; i++ {
+				result[b.Owner] = append(result[b.Owner], item.Price)
+			}
+		}
+	}
+	return result
+}
+
+func TestSplitBillsRoundRobin(t *testing.T) {
+	orders := []SellerOrder{
+		testOrder("b", 0, testItem("Lightning Bolt", 7, 2)),
+		testOrder("a", 0, testItem("Lightning Bolt", 5, 2)),
+	}
+	tests := []struct {
+		owners map[string]int
+		want   map[string][]float32
+	}{
+		{
+			owners: map[string]int{"bob": 2, "alice": 2},
+			want:   map[string][]float32{"alice": {5, 7}, "bob": {5, 7}},
+		},
+		{
+			owners: map[string]int{"bob": 3, "alice": 1},
+			want:   map[string][]float32{"alice": {5}, "bob": {5, 7, 7}},
+		},
+		{
+			owners: map[string]int{"alice": 3},
+			want:   map[string][]float32{"alice": {5, 5, 7}, Unassigned: {7}},
+		},
+	}
+	for _, tt := range tests {
+		bills := splitBills(map[string]map[string]int{"Lightning Bolt": tt.owners}, orders, SplitProportional)
+		if got := billPrices(bills); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("owners %v: expected %v, got %v", tt.owners, tt.want, got)
+		}
+	}
+}
+
+func TestSplitBillsDelivery(t *testing.T) {
+	orders := []SellerOrder{
+		testOrder("a", 10, testItem("Lightning Bolt", 10, 1), testItem("Counterspell", 30, 1)),
+		testOrder("b", 6, testItem("Shock", 2, 1)),
+	}
+	owners := map[string]map[string]int{
+		"Lightning Bolt": {"bob": 1},
+		"Counterspell":   {"alice": 1},
+		"Shock":          {"bob": 1},
+	}
+	tests := []struct {
+		mode SplitMode
+		want map[string]float32
+	}{
+		{SplitProportional, map[string]float32{"alice": 7.5, "bob": 2.5 + 6}},
+		{SplitEqual, map[string]float32{"alice": 5, "bob": 5 + 6}},
+	}
+	for _, tt := range tests {
+		bills := splitBills(owners, orders, tt.mode)
+		got := make(map[string]float32)
+		for _, b := range bills {
+			got[b.Owner] = b.Delivery
+			if b.Total != b.Cards+b.Delivery {
+				t.Errorf("%q: total of %s is %v, %v + %v is expected", tt.mode, b.Owner, b.Total, b.Cards, b.Delivery)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected delivery %v, got %v", tt.mode, tt.want, got)
+		}
+	}
+}
+
+func TestSplitBillsReportsUnassignedCopies(t *testing.T) {
+	orders := []SellerOrder{
+		testOrder("a", 20, testItem("Lightning Bolt", 5, 1), testItem("Counterspell", 15, 1)),
+	}
+	owners := map[string]map[string]int{"Lightning Bolt": {"alice": 1}}
+	bills := splitBills(owners, orders, SplitProportional)
+	if len(bills) != 2 || bills[0].Owner != Unassigned || bills[1].Owner != "alice" {
+		t.Fatalf("bills of nobody and alice are expected, got %+v", bills)
+	}
+	if b := bills[0]; len(b.Items) != 1 || b.Items[0].Card != "Counterspell" || b.Cards != 15 || b.Delivery != 15 {
+		t.Errorf("unexpected bill of nobody %+v", b)
+	}
+	var total float32
+	for _, b := range bills {
+		total += b.Total
+	}
+	if math.Abs(float64(total-orders[0].Total)) > 0.01 {
+		t.Errorf("bills add up to %v, orders cost %v", total, orders[0].Total)
+	}
+}
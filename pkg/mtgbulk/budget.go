@@ -0,0 +1,227 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Priority tells how much a card line is wanted when the budget does not allow to buy everything.
+type Priority struct {
+	// Must lines are bought in full or the request fails
+	Must bool
+	// Weight is the value of a single copy, 1 if 0
+	Weight float64
+}
+
+// ParsePriority reads "must", "nice" or a positive number which is a weight of a single copy.
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "must":
+		return Priority{Must: true}, nil
+	case "nice":
+		return Priority{Weight: 1}, nil
+	}
+	w, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+		return Priority{}, fmt.Errorf("priority is expected to be must, nice or a positive number, got %q", s)
+	}
+	return Priority{Weight: w}, nil
+}
+
+func (p Priority) weight() float64 {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+// BudgetError tells that even the cards which must be bought do not fit the budget.
+type BudgetError struct {
+	Budget float32
+	// Required is the cheapest price found for the must cards
+	Required float32
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("must cards cost at least %.2f which is over the budget of %.2f", e.Required, e.Budget)
+}
+
+// fitGreedyBudget keeps the copies chosen by calcGreedyMinPrices which fit the budget:
+// must lines first, then copies with the highest weight per price. It returns copies left out per card.
+func fitGreedyBudget(req NamesRequest, minPrices map[string][]CardPrice) (map[string][]CardPrice, map[string]int, error) {
+	type copyOffer struct {
+		card  string
+		offer CardPrice
+		ratio float64
+	}
+	var spent float64
+	var optional []copyOffer
+	result := make(map[string][]CardPrice, len(minPrices))
+	for name, prices := range minPrices {
+		prio := req.Priorities[name]
+		for _, cp := range prices {
+			if prio.Must {
+				result[name] = append(result[name], cp)
+				spent += float64(cp.Price) * float64(cp.Quantity)
+				continue
+			}
+			for i := 0; i < cp.Quantity; i++ {
+				ratio := math.Inf(1)
+				if cp.Price > 0 {
+					ratio = prio.weight() / float64(cp.Price)
+				}
+				optional = append(optional, copyOffer{card: name, offer: cp, ratio: ratio})
+			}
+		}
+	}
+	if spent > float64(req.Budget) {
+		return nil, nil, &BudgetError{Budget: req.Budget, Required: float32(spent)}
+	}
+
+	sort.SliceStable(optional, func(i, j int) bool {
+		if optional[i].ratio != optional[j].ratio {
+			return optional[i].ratio > optional[j].ratio
+		}
+		return optional[i].card < optional[j].card
+	})
+	deferred := make(map[string]int)
+	for _, c := range optional {
+		if spent+float64(c.offer.Price) > float64(req.Budget) {
+			deferred[c.card]++
+			continue
+		}
+		spent += float64(c.offer.Price)
+		prices := result[c.card]
+		if n := len(prices); n > 0 && prices[n-1].SellerFullName() == c.offer.SellerFullName() && prices[n-1].Price == c.offer.Price {
+			prices[n-1].Quantity++
+		} else {
+			cp := c.offer
+			cp.Quantity = 1
+			result[c.card] = append(prices, cp)
+		}
+	}
+	return result, deferred, nil
+}
+
+// realCost is the amount of money actually paid for the assignment.
+func (p *deliveryProblem) realCost(a assignment) float64 {
+	total := 0.0
+	for si, subtotal := range p.subtotals(a) {
+		total += float64(subtotal) + float64(p.delivery[si].Cost(subtotal))
+	}
+	return total
+}
+
+// usedSellers returns the sellers of the assignment as a set suitable for assign.
+func (p *deliveryProblem) usedSellers(a assignment) []bool {
+	allowed := make([]bool, len(p.sellers))
+	for si := range p.subtotals(a) {
+		allowed[si] = true
+	}
+	return allowed
+}
+
+// fitBudget reduces needed copies so that a plan fits the budget, starting from assignment a of all copies.
+// It drops copies with the lowest weight per money saved, delivery included, until the budget is met,
+// searches for a better set of sellers for what is left and then adds back copies which still fit.
+// It is a heuristic, the best subset is not guaranteed.
+func (p *deliveryProblem) fitBudget(solve func(k int) *planCandidates, budget float64, a assignment) (assignment, error) {
+	wanted := append([]int(nil), p.need...)
+
+	// nothing helps if must cards do not fit
+	for ci := range p.need {
+		if !p.must[ci] {
+			p.need[ci] = 0
+		}
+	}
+	top := solve(1)
+	if len(top.items) == 0 {
+		return nil, &SellerLimitError{MaxSellers: p.maxSellers, Cards: p.uncoveredCards()}
+	}
+	mustOnly := top.items[0].a
+	if c := p.realCost(mustOnly); c > budget {
+		return nil, &BudgetError{Budget: float32(budget), Required: float32(c)}
+	}
+	copy(p.need, wanted)
+
+	allowed := p.usedSellers(a)
+	current := p.realCost(a)
+	for current > budget {
+		bestCI := -1
+		var bestRatio, bestCost float64
+		var bestAssignment assignment
+		for ci := range p.need {
+			if p.must[ci] || p.need[ci] == 0 {
+				continue
+			}
+			p.need[ci]--
+			candidate, _ := p.assign(allowed)
+			p.need[ci]++
+			c := p.realCost(candidate)
+			saved := current - c
+			if saved <= 0 {
+				continue
+			}
+			if ratio := p.weights[ci] / saved; bestCI < 0 || ratio < bestRatio {
+				bestCI, bestRatio, bestCost, bestAssignment = ci, ratio, c, candidate
+			}
+		}
+		if bestCI < 0 {
+			// dropping copies from these sellers does not help, start from must cards only
+			for ci := range p.need {
+				if !p.must[ci] {
+					p.need[ci] = 0
+				}
+			}
+			a, current = mustOnly, p.realCost(mustOnly)
+			break
+		}
+		p.need[bestCI]--
+		a, current = bestAssignment, bestCost
+	}
+
+	// fewer copies might be cheaper with other sellers
+	if top := solve(1); len(top.items) > 0 {
+		if c := p.realCost(top.items[0].a); c < current {
+			a, current = top.items[0].a, c
+		}
+	}
+
+	allowed = p.usedSellers(a)
+	for {
+		bestCI := -1
+		var bestRatio, bestCost float64
+		var bestAssignment assignment
+		for ci := range p.need {
+			if p.need[ci] >= wanted[ci] {
+				continue
+			}
+			p.need[ci]++
+			candidate, complete := p.assign(allowed)
+			p.need[ci]--
+			if !complete {
+				continue
+			}
+			c := p.realCost(candidate)
+			if c > budget {
+				continue
+			}
+			ratio := math.Inf(1)
+			if c > current {
+				ratio = p.weights[ci] / (c - current)
+			}
+			if bestCI < 0 || ratio > bestRatio {
+				bestCI, bestRatio, bestCost, bestAssignment = ci, ratio, c, candidate
+			}
+		}
+		if bestCI < 0 {
+			break
+		}
+		p.need[bestCI]++
+		a, current = bestAssignment, bestCost
+	}
+	return a, nil
+}
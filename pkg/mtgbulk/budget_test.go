@@ -0,0 +1,186 @@
+package mtgbulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFitGreedyBudget(t *testing.T) {
+	minPrices := map[string][]CardPrice{
+		"Lightning Bolt": {{Price: 10, Quantity: 1, Trader: "a"}},
+		"Counterspell":   {{Price: 20, Quantity: 2, Trader: "b"}},
+		"Shock":          {{Price: 5, Quantity: 1, Trader: "a"}},
+	}
+	priorities := map[string]Priority{
+		"Lightning Bolt": {Must: true},
+		"Shock":          {Weight: 3},
+	}
+	tests := []struct {
+		budget   float32
+		deferred map[string]int
+		err      bool
+	}{
+		{budget: 100, deferred: map[string]int{}},
+		{budget: 40, deferred: map[string]int{"Counterspell": 1}},
+		{budget: 15, deferred: map[string]int{"Counterspell": 2}},
+		{budget: 12, deferred: map[string]int{"Counterspell": 2, "Shock": 1}},
+		{budget: 9, err: true},
+	}
+	for _, tt := range tests {
+		req := NamesRequest{Budget: tt.budget, Priorities: priorities}
+		got, deferred, err := fitGreedyBudget(req, minPrices)
+		if tt.err {
+			var budgetErr *BudgetError
+			if !errors.As(err, &budgetErr) || budgetErr.Required != 10 || budgetErr.Budget != tt.budget {
+				t.Errorf("budget %v: BudgetError requiring 10 is expected, got %v", tt.budget, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("budget %v: unexpected error: %s", tt.budget, err)
+			continue
+		}
+		if !reflect.DeepEqual(deferred, tt.deferred) {
+			t.Errorf("budget %v: expected deferred %v, got %v", tt.budget, tt.deferred, deferred)
+		}
+		var spent float32
+		for name, prices := range got {
+			bought := 0
+			for _, cp := range prices {
+				spent += cp.Price * float32(cp.Quantity)
+				bought += cp.Quantity
+			}
+			requested := 0
+			for _, cp := range minPrices[name] {
+				requested += cp.Quantity
+			}
+			if bought+deferred[name] != requested {
+				t.Errorf("budget %v: %d of %d copies of %s are bought and %d deferred", tt.budget, bought, requested, name, deferred[name])
+			}
+		}
+		if spent > tt.budget {
+			t.Errorf("budget %v: %v is spent", tt.budget, spent)
+		}
+	}
+}
+
+// checkBudgetPlans checks that plans fit the budget and account for every copy: bought, deferred or missing.
+func checkBudgetPlans(t *testing.T, req NamesRequest, rules *DeliveryRules, cards map[string]CardResult) {
+	t.Helper()
+	p := newDeliveryProblem(req, rules, cards)
+	// the seller limit applies to the whole list whatever the budget is
+	feasible := !math.IsInf(cheapestPlan(p), 1)
+	for ci := range p.need {
+		if !p.must[ci] {
+			p.need[ci] = 0
+		}
+	}
+	mustCost := cheapestPlan(p)
+
+	plans, err := evaluateConsideringDelivery(context.Background(), req, rules, cards)
+	if !feasible {
+		var limitErr *SellerLimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("SellerLimitError is expected, got %v", err)
+		}
+		return
+	}
+	if mustCost > float64(req.Budget)+0.01 {
+		var budgetErr *BudgetError
+		if !errors.As(err, &budgetErr) {
+			t.Fatalf("must cards cost %v, BudgetError is expected, got %v", mustCost, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i, plan := range plans {
+		if plan.Total > req.Budget+0.01 {
+			t.Errorf("plan %d costs %v, the budget is %v", i, plan.Total, req.Budget)
+		}
+		bought := make(map[string]int)
+		for _, o := range plan.Sellers {
+			for _, item := range o.Items {
+				bought[item.Card] += item.Quantity
+			}
+		}
+		for name, n := range req.Cards {
+			if got := bought[name] + plan.Deferred[name] + plan.Shortfalls[name]; got != n {
+				t.Errorf("plan %d: %d copies of %s are requested, %d are bought, deferred or missing", i, n, name, got)
+			}
+			if req.Priorities[name].Must && plan.Deferred[name] > 0 {
+				t.Errorf("plan %d: must card %s is deferred", i, name)
+			}
+		}
+	}
+}
+
+func TestDeliveryPlansFitBudget(t *testing.T) {
+	cards := testCards(map[string][]testOffer{
+		"Lightning Bolt": {{"a", 10, 2}, {"b", 8, 1}},
+		"Counterspell":   {{"b", 20, 2}, {"a", 25, 1}},
+		"Shock":          {{"a", 5, 4}},
+	})
+	rules := &DeliveryRules{Default: DeliveryPolicy{Fee: 10}}
+	priorities := map[string]Priority{"Lightning Bolt": {Must: true}, "Shock": {Weight: 3}}
+	for _, budget := range []float32{200, 80, 50, 35, 29} {
+		budget := budget
+		t.Run(fmt.Sprint(budget), func(t *testing.T) {
+			req := NamesRequest{
+				Cards:        map[string]int{"Lightning Bolt": 2, "Counterspell": 2, "Shock": 3},
+				Priorities:   priorities,
+				Budget:       budget,
+				Strategy:     StrategyExact,
+				Alternatives: 2,
+				PlanBudget:   5 * time.Second,
+			}
+			checkBudgetPlans(t, req, rules, cards)
+		})
+	}
+}
+
+func TestDeliveryPlansFitBudgetRandomly(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	names := []string{"Lightning Bolt", "Counterspell", "Shock"}
+	sellers := []string{"a", "b", "c"}
+	for i := 0; i < 200; i++ {
+		cards := make(map[string]int)
+		offers := make(map[string][]testOffer)
+		priorities := make(map[string]Priority)
+		for _, name := range names {
+			cards[name] = 1 + rnd.Intn(3)
+			switch rnd.Intn(3) {
+			case 0:
+				priorities[name] = Priority{Must: true}
+			case 1:
+				priorities[name] = Priority{Weight: float64(1 + rnd.Intn(5))}
+			}
+			for _, s := range sellers {
+				if rnd.Intn(3) > 0 {
+					offers[name] = append(offers[name], testOffer{s, float32(1 + rnd.Intn(30)), 1 + rnd.Intn(3)})
+				}
+			}
+		}
+		req := NamesRequest{
+			Cards:        cards,
+			Priorities:   priorities,
+			Budget:       float32(10 + rnd.Intn(150)),
+			Strategy:     StrategyExact,
+			MaxSellers:   rnd.Intn(3),
+			Alternatives: rnd.Intn(3),
+			PlanBudget:   5 * time.Second,
+		}
+		rules := &DeliveryRules{Default: DeliveryPolicy{Fee: float32(rnd.Intn(20))}}
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			checkBudgetPlans(t, req, rules, testCards(offers))
+		})
+	}
+}
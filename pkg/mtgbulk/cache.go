@@ -0,0 +1,181 @@
+package mtgbulk
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DiskCache stores search results on disk, so they can be reused by subsequent runs and by other processes.
+type DiskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	Platform string
+	// BaseURL is the site the result has been scraped from, empty if the searcher does not tell it
+	BaseURL string `json:",omitempty"`
+	Query   string
+	Stored  time.Time
+	Result  CardResult
+}
+
+// BaseURLSearcher is implemented by searchers which know the site they scrape.
+// Results of the same platform scraped from different sites, e.g. from a mirror, are cached apart.
+type BaseURLSearcher interface {
+	BaseURL() string
+}
+
+func searcherBaseURL(s Searcher) string {
+	if bs, ok := s.(BaseURLSearcher); ok {
+		return bs.BaseURL()
+	}
+	return ""
+}
+
+func (s *wrappedSearcher) BaseURL() string {
+	return searcherBaseURL(s.Searcher)
+}
+
+type cacheRefreshKey struct{}
+
+// WithCacheRefresh marks ctx so that cached results are ignored and replaced with fresh ones.
+func WithCacheRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheRefreshKey{}, true)
+}
+
+func cacheRefreshRequested(ctx context.Context) bool {
+	refresh, _ := ctx.Value(cacheRefreshKey{}).(bool)
+	return refresh
+}
+
+// DefaultCacheDir returns a per-user cache directory shared by all mtgbulkbuy binaries.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mtgbulkbuy"), nil
+}
+
+// NewDiskCache creates a cache in dir. Entries older than ttl are considered stale.
+func NewDiskCache(dir string, ttl time.Duration) (*DiskCache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache TTL must be positive, got %s", ttl)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("cannot create cache dir: %w", err)
+	}
+	return &DiskCache{
+		dir: dir,
+		ttl: ttl,
+	}, nil
+}
+
+func normalizeQuery(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+func (c *DiskCache) path(platform, baseURL, query string) string {
+	sum := sha1.Sum([]byte(baseURL + "\n" + query))
+	return filepath.Join(c.dir, platform, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get returns a fresh cached result of searching query at platform scraped from baseURL.
+func (c *DiskCache) Get(platform, baseURL, query string) (CardResult, bool) {
+	query = normalizeQuery(query)
+	data, err := ioutil.ReadFile(c.path(platform, baseURL, query))
+	if err != nil {
+		return CardResult{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		logger.Warnw("broken cache entry",
+			"platform", platform,
+			"query", query,
+			"err", err)
+		return CardResult{}, false
+	}
+	if entry.Platform != platform || entry.BaseURL != baseURL || entry.Query != query || time.Since(entry.Stored) > c.ttl {
+		return CardResult{}, false
+	}
+	return entry.Result, true
+}
+
+// Put stores a result of searching query at platform scraped from baseURL.
+func (c *DiskCache) Put(platform, baseURL, query string, res CardResult) error {
+	query = normalizeQuery(query)
+	data, err := json.Marshal(cacheEntry{
+		Platform: platform,
+		BaseURL:  baseURL,
+		Query:    query,
+		Stored:   time.Now(),
+		Result:   res,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := c.path(platform, baseURL, query)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	// write and rename, so concurrent readers never see a partially written entry
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Middleware serves search results from the cache and stores complete results of fresh searches.
+func (c *DiskCache) Middleware() Middleware {
+	return func(s Searcher) Searcher {
+		return WrapSearcher(s, func(ctx context.Context, q SearchQuery) (CardResult, error) {
+			if !cacheRefreshRequested(ctx) {
+				if res, found := c.Get(s.Name(), searcherBaseURL(s), q.Name); found {
+					logger.Debugw("cache hit",
+						"platform", s.Name(),
+						"card", q.Name)
+					for i := range res.Diagnostics {
+						res.Diagnostics[i].Cached = true
+					}
+					return res, nil
+				}
+			}
+
+			res, err := s.Search(ctx, q)
+			if err != nil {
+				return res, err
+			}
+			for _, d := range res.Diagnostics {
+				if !d.Complete() {
+					return res, nil
+				}
+			}
+			if err := c.Put(s.Name(), searcherBaseURL(s), q.Name, res); err != nil {
+				logger.Warnw("could not store search result in cache",
+					"platform", s.Name(),
+					"card", q.Name,
+					"err", err)
+			}
+			return res, nil
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package mtgbulk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// siteSearcher is a fakeSearcher scraping a known site
+type siteSearcher struct {
+	fakeSearcher
+	baseURL string
+}
+
+func (s *siteSearcher) BaseURL() string { return s.baseURL }
+
+func TestDiskCacheKeepsSitesApart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtgbulk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache, err := NewDiskCache(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	searches := make(map[string]int)
+	newSearcher := func(baseURL string, price float32) Searcher {
+		return cache.Middleware()(&siteSearcher{
+			fakeSearcher: fakeSearcher{name: "fake", search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+				searches[baseURL]++
+				return CardResult{
+					Available:   true,
+					Prices:      []CardPrice{{Price: price, Quantity: 1}},
+					Diagnostics: []SearchDiagnostics{{Platform: "fake", Status: SearchOK}},
+				}, nil
+			}},
+			baseURL: baseURL,
+		})
+	}
+	mirror := newSearcher("http://localhost:8080", 1)
+	production := newSearcher("https://example.com", 100)
+
+	q := SearchQuery{Name: "Lightning Bolt"}
+	if _, err := mirror.Search(context.Background(), q); err != nil {
+		t.Fatal(err)
+	}
+	res, err := production.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Prices[0].Price != 100 || res.Diagnostics[0].Cached {
+		t.Errorf("the result of the mirror has been served to production: %+v", res)
+	}
+	res, err = production.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Prices[0].Price != 100 || !res.Diagnostics[0].Cached {
+		t.Errorf("the cached result of production is expected, got %+v", res)
+	}
+	if searches["http://localhost:8080"] != 1 || searches["https://example.com"] != 1 {
+		t.Errorf("one search per site is expected, got %v", searches)
+	}
+}
+
+// newTestCache creates a cache in a temporary dir removed after the test
+func newTestCache(t *testing.T, ttl time.Duration) *DiskCache {
+	dir, err := ioutil.TempDir("", "mtgbulk-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cache, err := NewDiskCache(dir, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+// countedSearcher finds a single offer with the given diagnostics and counts its searches
+func countedSearcher(searches *int, diag SearchDiagnostics) Searcher {
+	return &fakeSearcher{name: "fake", search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		*searches++
+		return CardResult{
+			Available:   true,
+			Prices:      []CardPrice{{Price: float32(*searches), Quantity: 1}},
+			Diagnostics: []SearchDiagnostics{diag},
+		}, nil
+	}}
+}
+
+func TestDiskCache(t *testing.T) {
+	complete := SearchDiagnostics{Platform: "fake", Status: SearchOK}
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		diag SearchDiagnostics
+		// wait is the time between searches
+		wait    time.Duration
+		refresh bool
+		// searches is the number of searches made by 2 calls
+		searches int
+		cached   bool
+	}{
+		{"fresh entry", time.Hour, complete, 0, false, 1, true},
+		{"expired entry", 50 * time.Millisecond, complete, 100 * time.Millisecond, false, 2, false},
+		{"refresh", time.Hour, complete, 0, true, 2, false},
+		{"failed search", time.Hour, SearchDiagnostics{Platform: "fake", Status: SearchFailed}, 0, false, 2, false},
+		{"cancelled search", time.Hour, SearchDiagnostics{Platform: "fake", Status: SearchCancelled}, 0, false, 2, false},
+		{"skipped rows", time.Hour, SearchDiagnostics{Platform: "fake", Status: SearchOK, RowsSkipped: 1}, 0, false, 2, false},
+		{"failed page", time.Hour, SearchDiagnostics{Platform: "fake", Status: SearchOK, HTTPCode: 500}, 0, false, 2, false},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var searches int
+			s := newTestCache(t, tc.ttl).Middleware()(countedSearcher(&searches, tc.diag))
+			q := SearchQuery{Name: "Lightning Bolt"}
+			if _, err := s.Search(context.Background(), q); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(tc.wait)
+			ctx := context.Background()
+			if tc.refresh {
+				ctx = WithCacheRefresh(ctx)
+			}
+			res, err := s.Search(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if searches != tc.searches {
+				t.Errorf("%d searches are expected, got %d", tc.searches, searches)
+			}
+			if res.Diagnostics[0].Cached != tc.cached {
+				t.Errorf("cached %v is expected, got %+v", tc.cached, res.Diagnostics[0])
+			}
+			if tc.cached && res.Prices[0].Price != 1 {
+				t.Errorf("the result of the first search is expected, got %+v", res.Prices)
+			}
+		})
+	}
+}
+
+func TestDiskCacheRefreshReplacesEntry(t *testing.T) {
+	var searches int
+	s := newTestCache(t, time.Hour).Middleware()(countedSearcher(&searches, SearchDiagnostics{Platform: "fake", Status: SearchOK}))
+	q := SearchQuery{Name: "Lightning Bolt"}
+	for _, ctx := range []context.Context{context.Background(), WithCacheRefresh(context.Background()), context.Background()} {
+		if _, err := s.Search(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := s.Search(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if searches != 2 || res.Prices[0].Price != 2 || !res.Diagnostics[0].Cached {
+		t.Errorf("the refreshed result is expected from the cache, got %d searches and %+v", searches, res)
+	}
+}
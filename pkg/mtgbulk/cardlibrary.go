@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -12,10 +13,24 @@ type Library interface {
 	EnglishName(string) (string, error)
 }
 
+// Suggester is implemented by libraries which can guess what an unknown name was meant to be.
+type Suggester interface {
+	// Suggest returns up to n known names closest to cardname, the closest first
+	Suggest(cardname string, n int) []string
+}
+
+// OracleIDResolver is implemented by libraries which can tell the Oracle ID of a card, so its printings
+// in any language are recognized as the same card.
+type OracleIDResolver interface {
+	// OracleID returns the Oracle ID of cardname. An Oracle ID itself is accepted as a name
+	OracleID(cardname string) (string, error)
+}
+
 type InMemoryLibrary struct {
 	cardIDtoNames       map[string]map[string]bool
 	cardNameToID        map[string]string
 	cardIDtoEnglishName map[string]string
+	setNames            map[string]string
 }
 
 type Card struct {
@@ -25,6 +40,8 @@ type Card struct {
 	LocalName string `json:"printed_name"`
 	Lang      string `json:"lang"`
 	URI       string `json:"uri"`
+	Set       string `json:"set"`
+	SetName   string `json:"set_name"`
 }
 
 func NewInMemoryLibrary(dumpPath string) (Library, error) {
@@ -44,6 +61,7 @@ func NewInMemoryLibrary(dumpPath string) (Library, error) {
 		cardIDtoNames:       make(map[string]map[string]bool),
 		cardNameToID:        make(map[string]string),
 		cardIDtoEnglishName: make(map[string]string),
+		setNames:            make(map[string]string),
 	}
 
 	for dec.More() {
@@ -52,6 +70,9 @@ func NewInMemoryLibrary(dumpPath string) (Library, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Cannot decode file with dump: %w", err)
 		}
+		if c.Set != "" && c.SetName != "" {
+			lib.setNames[strings.ToLower(c.Set)] = c.SetName
+		}
 		if c.Lang != "en" && c.Lang != "ru" {
 			continue
 		}
@@ -105,3 +126,93 @@ func (lib *InMemoryLibrary) EnglishName(cardname string) (string, error) {
 	}
 	return lib.cardIDtoEnglishName[id], nil
 }
+
+func (lib *InMemoryLibrary) OracleID(cardname string) (string, error) {
+	cardname = strings.ToLower(strings.TrimSpace(cardname))
+	if _, found := lib.cardIDtoNames[cardname]; found {
+		return cardname, nil
+	}
+	id, found := lib.cardNameToID[cardname]
+	if !found {
+		return "", fmt.Errorf("no Oracle ID for card: %s", cardname)
+	}
+	return id, nil
+}
+
+func (lib *InMemoryLibrary) SetName(code string) (string, bool) {
+	name, found := lib.setNames[strings.ToLower(strings.TrimSpace(code))]
+	return name, found
+}
+
+// Suggest returns known names within a few typos from cardname.
+func (lib *InMemoryLibrary) Suggest(cardname string, n int) []string {
+	cardname = strings.ToLower(strings.TrimSpace(cardname))
+	maxDistance := len([]rune(cardname)) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for name := range lib.cardNameToID {
+		if d := editDistance(cardname, name, maxDistance); d <= maxDistance {
+			candidates = append(candidates, candidate{name, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	result := make([]string, 0, n)
+	for i := 0; i < len(candidates) && i < n; i++ {
+		result = append(result, candidates[i].name)
+	}
+	return result
+}
+
+// editDistance is Levenshtein distance between a and b. Anything above limit is reported as limit+1.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if cur[j] < rowMin {
+				rowMin = cur[j]
+			}
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, cur = cur, prev
+	}
+	if prev[len(rb)] > limit {
+		return limit + 1
+	}
+	return prev[len(rb)]
+}
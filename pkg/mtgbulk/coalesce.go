@@ -0,0 +1,126 @@
+package mtgbulk
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Coalescer deduplicates identical searches running at the same time, so they share a single scrape.
+type Coalescer struct {
+	mu    sync.Mutex
+	calls map[coalesceKey]*coalescedCall
+}
+
+type coalesceKey struct {
+	// baseURL keeps searches of the same platform at different sites apart, like DiskCache does
+	platform, baseURL, query string
+	refresh                  bool
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	res     CardResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func NewCoalescer() *Coalescer {
+	return &Coalescer{
+		calls: make(map[coalesceKey]*coalescedCall),
+	}
+}
+
+// detachedContext keeps values of the parent context but is never cancelled with it.
+// The shared search must outlive the caller which has started it while other callers are still waiting.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// Middleware makes concurrent searches of the same card at the same platform share one search.
+// The shared search is cancelled only when all callers waiting for it are gone.
+func (c *Coalescer) Middleware() Middleware {
+	return func(s Searcher) Searcher {
+		return WrapSearcher(s, func(ctx context.Context, q SearchQuery) (CardResult, error) {
+			key := coalesceKey{
+				platform: s.Name(),
+				baseURL:  searcherBaseURL(s),
+				query:    normalizeQuery(q.Name),
+				refresh:  cacheRefreshRequested(ctx),
+			}
+
+			c.mu.Lock()
+			call, found := c.calls[key]
+			if found {
+				call.waiters++
+				logger.Debugw("joining in-flight search",
+					"platform", key.platform,
+					"card", q.Name,
+					"waiters", call.waiters)
+			} else {
+				var callCtx context.Context
+				callCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+				call = &coalescedCall{
+					done:    make(chan struct{}),
+					waiters: 1,
+					cancel:  cancel,
+				}
+				c.calls[key] = call
+				go func() {
+					call.res, call.err = s.Search(callCtx, q)
+					c.mu.Lock()
+					// an abandoned call might have been replaced by a new one already
+					if c.calls[key] == call {
+						delete(c.calls, key)
+					}
+					c.mu.Unlock()
+					cancel()
+					close(call.done)
+				}()
+			}
+			c.mu.Unlock()
+
+			select {
+			case <-call.done:
+				return copyCardResult(call.res), call.err
+			case <-ctx.Done():
+				c.mu.Lock()
+				call.waiters--
+				if call.waiters == 0 {
+					// nobody must join the cancelled search
+					if c.calls[key] == call {
+						delete(c.calls, key)
+					}
+					call.cancel()
+				}
+				c.mu.Unlock()
+				return CardResult{}, ctx.Err()
+			}
+		})
+	}
+}
+
+// copyCardResult makes a copy which can be modified without affecting other callers sharing the result.
+func copyCardResult(res CardResult) CardResult {
+	cp := res
+	cp.Prices = append([]CardPrice(nil), res.Prices...)
+	cp.Diagnostics = append([]SearchDiagnostics(nil), res.Diagnostics...)
+	return cp
+}
@@ -0,0 +1,151 @@
+package mtgbulk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSearcher searches with a function instead of scraping
+type fakeSearcher struct {
+	name   string
+	search SearchFunc
+}
+
+func (s *fakeSearcher) Name() string           { return s.name }
+func (s *fakeSearcher) Platform() PlatformType { return MtgSale }
+func (s *fakeSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q)
+}
+
+func TestCoalescerSharesSearch(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	s := NewCoalescer().Middleware()(&fakeSearcher{name: "fake", search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return CardResult{Available: true, Prices: []CardPrice{{Price: 1, Quantity: 1}}}, nil
+	}})
+
+	var wg sync.WaitGroup
+	results := make([]CardResult, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+			if err != nil {
+				t.Errorf("search failed: %s", err)
+			}
+			results[i] = res
+		}(i)
+	}
+	// let all callers join before the search finishes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("1 search is expected, got %d", n)
+	}
+	for i, res := range results {
+		if len(res.Prices) != 1 {
+			t.Errorf("caller %d: unexpected result %+v", i, res)
+		}
+	}
+}
+
+func TestCoalescerDoesNotJoinAbandonedSearch(t *testing.T) {
+	var calls int32
+	abandoned := make(chan struct{})
+	release := make(chan struct{})
+	s := NewCoalescer().Middleware()(&fakeSearcher{name: "fake", search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the first search is slow to notice the cancellation
+			<-ctx.Done()
+			close(abandoned)
+			<-release
+			return CardResult{}, ctx.Err()
+		}
+		return CardResult{Available: true}, nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.Search(ctx, SearchQuery{Name: "Lightning Bolt"})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller: context.Canceled is expected, got %v", err)
+	}
+	<-abandoned
+
+	type result struct {
+		res CardResult
+		err error
+	}
+	second := make(chan result)
+	go func() {
+		res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+		second <- result{res, err}
+	}()
+	var r result
+	select {
+	case r = <-second:
+		close(release)
+	case <-time.After(time.Second):
+		close(release)
+		r = <-second
+		t.Fatalf("new caller has joined the abandoned search, got %+v, %v", r.res, r.err)
+	}
+	if r.err != nil {
+		t.Fatalf("new caller got error of the abandoned search: %s", r.err)
+	}
+	if n := atomic.LoadInt32(&calls); !r.res.Available || n != 2 {
+		t.Errorf("a new search is expected, got %+v after %d searches", r.res, n)
+	}
+}
+
+func TestCoalescerKeepsSitesApart(t *testing.T) {
+	release := make(chan struct{})
+	coalescer := NewCoalescer()
+	newSearcher := func(baseURL string, price float32) Searcher {
+		return coalescer.Middleware()(&siteSearcher{
+			fakeSearcher: fakeSearcher{name: "fake", search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+				<-release
+				return CardResult{Available: true, Prices: []CardPrice{{Price: price, Quantity: 1}}}, nil
+			}},
+			baseURL: baseURL,
+		})
+	}
+	searchers := []Searcher{newSearcher("http://localhost:8080", 1), newSearcher("https://example.com", 100)}
+
+	var wg sync.WaitGroup
+	results := make([]CardResult, len(searchers))
+	for i, s := range searchers {
+		wg.Add(1)
+		go func(i int, s Searcher) {
+			defer wg.Done()
+			res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+			if err != nil {
+				t.Errorf("search failed: %s", err)
+			}
+			results[i] = res
+		}(i, s)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, want := range []float32{1, 100} {
+		if len(results[i].Prices) != 1 || results[i].Prices[0].Price != want {
+			t.Errorf("searcher %d: the offer for %v is expected, got %+v", i, want, results[i])
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package mtgbulk
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gocolly/colly"
+)
+
+// contextTransport binds every outgoing request to ctx, so in-flight requests are aborted on cancellation.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// newCollector creates a collector which stops sending requests and aborts in-flight ones once ctx is done.
+// http.DefaultTransport is used if base is nil.
+func newCollector(ctx context.Context, base http.RoundTripper) *colly.Collector {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c := colly.NewCollector()
+	c.WithTransport(&contextTransport{ctx: ctx, base: base})
+	// timeouts are up to HTTPPolicy which limits every attempt separately
+	c.SetRequestTimeout(0)
+	c.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil {
+			logger.Debugw("request aborted",
+				"url", r.URL.String(),
+				"err", ctx.Err())
+			r.Abort()
+		}
+	})
+	return c
+}
@@ -0,0 +1,137 @@
+package mtgbulk
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config describes how built-in platforms are accessed. It is usually loaded from a JSON file.
+type Config struct {
+	// Platforms is keyed by platform name, e.g. "MtgSale"
+	Platforms map[string]PlatformConfig `json:"platforms"`
+
+	// HTTPMode allows to record all HTTP exchanges to FixturesDir or to replay them from it
+	HTTPMode    HTTPMode `json:"http_mode"`
+	FixturesDir string   `json:"fixtures_dir"`
+
+	// HTTP is applied to all platforms. DefaultHTTPPolicy is used if nil
+	HTTP *HTTPPolicy `json:"http"`
+
+	// Delivery describes shipping prices of sellers and platforms for delivery-aware plans
+	Delivery *DeliveryRules `json:"delivery"`
+	// Sellers blocks, allows and weights sellers
+	Sellers *SellerPolicy `json:"sellers"`
+}
+
+type PlatformConfig struct {
+	// BaseURL replaces scheme and host of the production site, e.g. a local mirror or a staging proxy
+	BaseURL  string `json:"base_url"`
+	Disabled bool   `json:"disabled"`
+	// InsecureSkipVerify disables TLS certificate checks, useful for proxies with self-signed certificates
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+var builtinSearchers = []struct {
+	platform PlatformType
+	create   func(SearcherOptions) Searcher
+}{
+	{MtgSale, NewMtgSaleSearcher},
+	{MtgTrade, NewMtgTradeSearcher},
+	{SpellMarket, NewSpellMarketSearcher},
+	{AutumnsMagic, NewAutumnsMagicSearcher},
+	{TopDeck, NewTopDeckSearcher},
+}
+
+// renamedPlatforms are old platform names, configs using them fail with the new name
+var renamedPlatforms = map[string]string{
+	"AutumsMagic": AutumnsMagic.String(),
+}
+
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, fmt.Errorf("Cannot open config: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("Cannot decode config %q: %w", path, err)
+	}
+	if cfg.Delivery != nil {
+		if err := cfg.Delivery.Validate(); err != nil {
+			return cfg, fmt.Errorf("Bad delivery in config %q: %w", path, err)
+		}
+	}
+	if cfg.Sellers != nil {
+		if err := cfg.Sellers.Validate(); err != nil {
+			return cfg, fmt.Errorf("Bad sellers in config %q: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// NewConfiguredRegistry returns a registry with all built-in platforms set up according to cfg.
+func NewConfiguredRegistry(cfg Config) (*Registry, error) {
+	known := make(map[string]bool, len(builtinSearchers))
+	for _, b := range builtinSearchers {
+		known[b.platform.String()] = true
+	}
+	for name := range cfg.Platforms {
+		if renamed, found := renamedPlatforms[name]; found {
+			return nil, fmt.Errorf("platform %q in config has been renamed to %q", name, renamed)
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("unknown platform %q in config", name)
+		}
+	}
+
+	if cfg.HTTPMode != HTTPModeLive && cfg.FixturesDir == "" {
+		return nil, fmt.Errorf("fixtures dir is required for HTTP mode %q", cfg.HTTPMode)
+	}
+
+	policy := DefaultHTTPPolicy
+	if cfg.HTTP != nil {
+		policy = *cfg.HTTP
+		if err := policy.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.HTTPMode == HTTPModeReplay {
+		// recorded responses need neither delays nor retries
+		policy = HTTPPolicy{}
+	}
+
+	r := NewRegistry()
+	for _, b := range builtinSearchers {
+		pc := cfg.Platforms[b.platform.String()]
+		opts := SearcherOptions{
+			BaseURL: pc.BaseURL,
+			HTTP:    &policy,
+		}
+		base := policy.baseTransport()
+		if pc.InsecureSkipVerify {
+			base.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		tr, err := withHTTPMode(cfg.HTTPMode, cfg.FixturesDir, base)
+		if err != nil {
+			return nil, err
+		}
+		opts.Transport = tr
+
+		s := b.create(opts)
+		if err := r.Register(s); err != nil {
+			return nil, err
+		}
+		if pc.Disabled {
+			if err := r.Disable(s.Name()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,325 @@
+package mtgbulk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DeckFormat is a format of a card list.
+type DeckFormat string
+
+const (
+	// FormatAuto guesses the format by the content
+	FormatAuto DeckFormat = ""
+	// FormatText is "N[x] name [priority] @owner" per line, see ParseText
+	FormatText DeckFormat = "text"
+	// FormatArena is an MTG Arena export: "N name (SET) 123" lines under Deck, Sideboard, Commander headers
+	FormatArena DeckFormat = "arena"
+	// FormatMTGO is an MTGO .dek XML file
+	FormatMTGO DeckFormat = "mtgo"
+	// FormatCSV is a CSV export with a header, e.g. of Moxfield or Archidekt
+	FormatCSV DeckFormat = "csv"
+)
+
+// ParseDeckFormat checks that s is a known format, an empty string means FormatAuto.
+func ParseDeckFormat(s string) (DeckFormat, error) {
+	switch f := DeckFormat(strings.ToLower(s)); f {
+	case FormatAuto, FormatText, FormatArena, FormatMTGO, FormatCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown deck format %q", s)
+}
+
+// ListLine is a line of a card list as it has been written.
+type ListLine struct {
+	Name     string
+	Quantity int
+	// Line is the number of the line starting from 1, 0 if the format has no lines like MTGO .dek
+	Line int `json:",omitempty"`
+	// Section is the part of a deck the line belongs to, e.g. "Deck" or "Sideboard". Empty if the list has no sections
+	Section string `json:",omitempty"`
+	// Set is the set code of the line. Sets of Arena, MTGO and CSV lists are kept for reference only,
+	// offers are narrowed down by printings of text lines, see Printing
+	Set string `json:",omitempty"`
+	// CollectorNumber is kept as written, it is not matched as no shop reports collector numbers
+	CollectorNumber string `json:",omitempty"`
+}
+
+// arenaLineRe matches "4 Lightning Bolt (M10) 146", the set and the number are optional
+var arenaLineRe *regexp.Regexp = regexp.MustCompile(`^(\d+)x?\s+(.*?)(?:\s+\(([A-Za-z0-9]+)\)(?:\s+(\S+))?)?$`)
+
+// arenaSetRe tells an Arena line from a plain one: "4 Lightning Bolt (M10) 146"
+var arenaSetRe *regexp.Regexp = regexp.MustCompile(`^\d+x?\s+.*\s\([A-Za-z0-9]{2,6}\)\s+[A-Za-z0-9-]+$`)
+
+var arenaSections = map[string]string{
+	"deck":       "Deck",
+	"main":       "Deck",
+	"mainboard":  "Deck",
+	"sideboard":  "Sideboard",
+	"commander":  "Commander",
+	"companion":  "Companion",
+	"maybeboard": "Maybeboard",
+}
+
+// ParseDeck reads a card list of the format into a request. Lines with the same card in different sections
+// are summed up in Cards, Lines keep them apart. Lines with errors are handled according to mode, see ParseTextMode.
+// Sets and collector numbers of Arena, MTGO and CSV lists do not narrow offers down, a warning tells so.
+func ParseDeck(r io.Reader, format DeckFormat, mode ValidationMode) (NamesRequest, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return NewNamesRequest(), err
+	}
+	if format == FormatAuto {
+		format = DetectDeckFormat(data)
+		logger.Debugw("deck format detected",
+			"format", format)
+	}
+
+	var req NamesRequest
+	switch format {
+	case FormatText:
+		return ParseTextMode(bytes.NewReader(data), mode)
+	case FormatArena:
+		req, err = parseArena(data)
+	case FormatMTGO:
+		req, err = parseMTGO(data)
+	case FormatCSV:
+		req, err = parseDeckCSV(data)
+	default:
+		return NewNamesRequest(), fmt.Errorf("unknown deck format %q", format)
+	}
+	if err != nil {
+		return req, err
+	}
+	req.reportPrintings()
+	return req.validate(mode)
+}
+
+// reportPrintings warns once per list that sets and collector numbers of its lines are not matched.
+func (req *NamesRequest) reportPrintings() {
+	for _, l := range req.Lines {
+		if l.Set != "" || l.CollectorNumber != "" {
+			req.issue(0, SeverityWarning, "sets and collector numbers of the list are not matched, any printing is bought")
+			return
+		}
+	}
+}
+
+// DetectDeckFormat guesses the format of a card list, FormatText is the fallback.
+// A list is taken for an Arena export if it starts with a section header or most of its lines have sets
+// and collector numbers, so a text line like "Fire // Ice (2)" does not change the format.
+func DetectDeckFormat(data []byte) DeckFormat {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<Deck")) {
+		return FormatMTGO
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	lines, arenaLines := 0, 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if lines == 0 {
+			if _, ok := deckCSVColumns(line); ok {
+				return FormatCSV
+			}
+			if _, found := arenaSections[strings.ToLower(line)]; found || strings.EqualFold(line, "about") {
+				return FormatArena
+			}
+		}
+		if _, found := arenaSections[strings.ToLower(line)]; found {
+			continue
+		}
+		lines++
+		if arenaSetRe.MatchString(line) {
+			arenaLines++
+		}
+	}
+	if arenaLines*2 > lines {
+		return FormatArena
+	}
+	return FormatText
+}
+
+func (req *NamesRequest) addLine(line ListLine) {
+	req.Cards[line.Name] += line.Quantity
+	req.Lines = append(req.Lines, line)
+}
+
+func parseArena(data []byte) (NamesRequest, error) {
+	req := NewNamesRequest()
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			// old exports separate the sideboard with an empty line
+			if section == "" && len(req.Lines) > 0 {
+				for i := range req.Lines {
+					req.Lines[i].Section = "Deck"
+				}
+				section = "Sideboard"
+			}
+			continue
+		}
+		if s, found := arenaSections[strings.ToLower(line)]; found {
+			section = s
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(line), "name ") || strings.EqualFold(line, "about") {
+			continue
+		}
+		m := arenaLineRe.FindStringSubmatch(line)
+		if m == nil {
+			req.issue(lineNo, SeverityError, "could not parse arena line %q", line)
+			continue
+		}
+		quantity, err := strconv.Atoi(m[1])
+		if err != nil || quantity <= 0 {
+			req.issue(lineNo, SeverityError, "illegal quantity for card %q has been requested: %s", m[2], m[1])
+			continue
+		}
+		req.addLine(ListLine{
+			Name:            m[2],
+			Quantity:        quantity,
+			Line:            lineNo,
+			Section:         section,
+			Set:             strings.ToUpper(m[3]),
+			CollectorNumber: m[4],
+		})
+	}
+	return req, scanner.Err()
+}
+
+type mtgoDeck struct {
+	Cards []struct {
+		Quantity  int    `xml:"Quantity,attr"`
+		Sideboard bool   `xml:"Sideboard,attr"`
+		Name      string `xml:"Name,attr"`
+	} `xml:"Cards"`
+}
+
+func parseMTGO(data []byte) (NamesRequest, error) {
+	req := NewNamesRequest()
+	var deck mtgoDeck
+	if err := xml.Unmarshal(data, &deck); err != nil {
+		return req, fmt.Errorf("could not parse .dek file: %w", err)
+	}
+	for _, c := range deck.Cards {
+		if c.Quantity <= 0 {
+			req.issue(0, SeverityError, "illegal quantity for card %q has been requested: %d", c.Name, c.Quantity)
+			continue
+		}
+		section := "Deck"
+		if c.Sideboard {
+			section = "Sideboard"
+		}
+		req.addLine(ListLine{Name: c.Name, Quantity: c.Quantity, Section: section})
+	}
+	return req, nil
+}
+
+// deckColumns are indices of known CSV columns, -1 if there is no such column
+type deckColumns struct {
+	name, count, set, number, section int
+}
+
+// deckCSVColumns recognizes a CSV header with a name column. ok is false if the line is not such a header.
+func deckCSVColumns(header string) (deckColumns, bool) {
+	cols := deckColumns{-1, -1, -1, -1, -1}
+	if !strings.Contains(header, ",") {
+		return cols, false
+	}
+	fields, err := csv.NewReader(strings.NewReader(header)).Read()
+	if err != nil {
+		return cols, false
+	}
+	set := func(col *int, i int) {
+		if *col < 0 {
+			*col = i
+		}
+	}
+	for i, f := range fields {
+		switch strings.ToLower(strings.TrimSpace(f)) {
+		case "name", "card", "card name", "cardname":
+			set(&cols.name, i)
+		case "count", "quantity", "qty":
+			set(&cols.count, i)
+		case "edition code", "set code", "set", "edition":
+			set(&cols.set, i)
+		case "collector number", "number", "collector_number":
+			set(&cols.number, i)
+		case "board", "section", "category":
+			set(&cols.section, i)
+		}
+	}
+	return cols, cols.name >= 0
+}
+
+func parseDeckCSV(data []byte) (NamesRequest, error) {
+	req := NewNamesRequest()
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return req, fmt.Errorf("could not read CSV header: %w", err)
+	}
+	cols, ok := deckCSVColumns(strings.Join(header, ","))
+	if !ok {
+		return req, fmt.Errorf("CSV header has no card name column: %q", strings.Join(header, ","))
+	}
+	// the header is line 1, records with line breaks inside make numbers of the following lines approximate
+	lineNo := 1
+	field := func(record []string, col int) string {
+		if col < 0 || col >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[col])
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		lineNo++
+		if err != nil {
+			req.issue(lineNo, SeverityError, "%s", err)
+			if _, ok := err.(*csv.ParseError); ok {
+				continue
+			}
+			return req, err
+		}
+		name := field(record, cols.name)
+		if name == "" {
+			continue
+		}
+		quantity := 1
+		if c := field(record, cols.count); c != "" {
+			quantity, err = strconv.Atoi(c)
+			if err != nil || quantity <= 0 {
+				req.issue(lineNo, SeverityError, "illegal quantity for card %q has been requested: %s", name, c)
+				continue
+			}
+		}
+		req.addLine(ListLine{
+			Name:            name,
+			Quantity:        quantity,
+			Line:            lineNo,
+			Section:         field(record, cols.section),
+			Set:             strings.ToUpper(field(record, cols.set)),
+			CollectorNumber: field(record, cols.number),
+		})
+	}
+	return req, nil
+}
@@ -0,0 +1,117 @@
+package mtgbulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// deckGolden is what is compared against testdata/decklists/<list>.golden.json
+type deckGolden struct {
+	Format     DeckFormat
+	Cards      map[string]int
+	Lines      []ListLine
+	Printings  map[string]Printing       `json:",omitempty"`
+	Priorities map[string]Priority       `json:",omitempty"`
+	Owners     map[string]map[string]int `json:",omitempty"`
+	Issues     []Issue                   `json:",omitempty"`
+	Error      string                    `json:",omitempty"`
+}
+
+// deckCases are lists in testdata/decklists parsed with the detected format in lenient mode
+var deckCases = []struct {
+	list   string
+	format DeckFormat
+}{
+	{"text.txt", FormatText},
+	{"arena.txt", FormatArena},
+	{"arena_blank_sideboard.txt", FormatArena},
+	{"mtgo.dek", FormatMTGO},
+	{"moxfield.csv", FormatCSV},
+	{"archidekt.csv", FormatCSV},
+}
+
+func TestParseDeckFixtures(t *testing.T) {
+	for _, tc := range deckCases {
+		tc := tc
+		t.Run(tc.list, func(t *testing.T) {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", "decklists", tc.list))
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := DetectDeckFormat(data)
+			if format != tc.format {
+				t.Errorf("format %q is expected, got %q", tc.format, format)
+			}
+			req, err := ParseDeck(bytes.NewReader(data), FormatAuto, ValidationLenient)
+			golden := deckGolden{
+				Format:     format,
+				Cards:      req.Cards,
+				Lines:      req.Lines,
+				Printings:  req.Printings,
+				Priorities: req.Priorities,
+				Owners:     req.Owners,
+				Issues:     req.Issues,
+			}
+			if err != nil {
+				golden.Error = err.Error()
+			}
+			actual, err := json.MarshalIndent(golden, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := filepath.Join("testdata", "decklists", strings.TrimSuffix(tc.list, filepath.Ext(tc.list))+".golden.json")
+			if *updateGolden {
+				if err := ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("no golden file, run with -update to create it: %s", err)
+			}
+			if string(expected) != string(actual) {
+				t.Errorf("result differs from %s\nexpected:\n%s\nactual:\n%s", goldenPath, expected, actual)
+			}
+		})
+	}
+}
+
+func TestDetectDeckFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want DeckFormat
+	}{
+		{"text", "4 Lightning Bolt\n1 Counterspell\n", FormatText},
+		{"text with commas", "2 Jace, the Mind Sculptor\n1 Borborygmos Enraged\n", FormatText},
+		{"text with a name column look-alike", "1 Name, the Card\n", FormatText},
+		{"text with priorities and owners", "4 Lightning Bolt [must] @alice\n", FormatText},
+		{"text with printings", "1 Volcanic Island {set=3ED}\n", FormatText},
+		{"text with a note in parentheses", "1 Fire // Ice (2)\n4 Lightning Bolt\n", FormatText},
+		{"text with a language in parentheses", "4 Lightning Bolt (RU)\n", FormatText},
+		{"text with a single arena line", "4 Lightning Bolt\n2 Pyroblast (ICE) 212\n1 Shock\n", FormatText},
+		{"text with a header inside", "4 Lightning Bolt\nSideboard\n2 Pyroblast\n", FormatText},
+		{"arena header", "Deck\n4 Lightning Bolt\n", FormatArena},
+		{"arena about", "About\nName Burn\n\nDeck\n4 Lightning Bolt\n", FormatArena},
+		{"arena sets", "4 Lightning Bolt (M10) 146\n", FormatArena},
+		{"arena after blank lines", "\n\n4 Lightning Bolt (M10) 146\n", FormatArena},
+		{"arena sideboard after an empty line", "4 Lightning Bolt (M10) 146\n\n2 Pyroblast (ICE) 212\n", FormatArena},
+		{"arena with most lines having sets", "4 Lightning Bolt (M10) 146\n2 Pyroblast (ICE) 212\n1 Shock\n", FormatArena},
+		{"mtgo", "<?xml version=\"1.0\"?>\n<Deck></Deck>\n", FormatMTGO},
+		{"mtgo without declaration", "  <Deck>\n</Deck>\n", FormatMTGO},
+		{"csv", "Count,Name\n4,Lightning Bolt\n", FormatCSV},
+		{"csv with quotes", "\"Quantity\",\"Card Name\"\n\"4\",\"Lightning Bolt\"\n", FormatCSV},
+		{"csv without a name column", "Count,Price\n4,10\n", FormatText},
+		{"csv header not first", "4 Lightning Bolt\nCount,Name\n", FormatText},
+	}
+	for _, tt := range tests {
+		if got := DetectDeckFormat([]byte(tt.list)); got != tt.want {
+			t.Errorf("%s: %q is expected, got %q", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,791 @@
+package mtgbulk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// maxExactNodes limits branch-and-bound, so a huge list cannot hang the request.
+const maxExactNodes = 2000000
+
+// PlanItem is a card bought from a particular offer. Quantity is the number of copies bought, not the stock of the offer.
+type PlanItem struct {
+	Card string
+	CardPrice
+}
+
+// SellerOrder is everything bought from a single seller, i.e. a single package.
+type SellerOrder struct {
+	Seller   string
+	Items    []PlanItem
+	Subtotal float32
+	Delivery float32
+	Total    float32
+}
+
+// PurchasePlan tells which card to buy from which seller.
+type PurchasePlan struct {
+	Sellers       []SellerOrder
+	CardsTotal    float32
+	DeliveryTotal float32
+	Total         float32
+	// Optimal is false if the search has been stopped before the plan has been proven to be the cheapest one
+	Optimal bool
+	// LowerBound is the cost no plan can go below, so Total - LowerBound is how much could be saved at most.
+	// With seller preferences both the bound and the cost use weighted prices
+	LowerBound float32
+	// Strategy is the one actually used to find the plan
+	Strategy PlanStrategy
+	// SellerCount is the number of sellers, i.e. packages
+	SellerCount int
+	// Value is the sum of priority weights of all copies bought
+	Value float64
+	// Deferred lists copies left out to fit the money budget: card name -> copies
+	Deferred map[string]int `json:",omitempty"`
+	// Shortfalls lists cards which cannot be bought in the requested quantity: card name -> missing copies
+	Shortfalls map[string]int `json:",omitempty"`
+}
+
+// singles returns the offer chosen for every card. It is meaningful only if a single copy of every card is bought.
+func (p *PurchasePlan) singles() map[string]CardPrice {
+	result := make(map[string]CardPrice)
+	for _, o := range p.Sellers {
+		for _, item := range o.Items {
+			result[item.Card] = item.CardPrice
+		}
+	}
+	return result
+}
+
+type sellerOffer struct {
+	seller int
+	offer  CardPrice
+	// price is the price of a copy weighted by seller preferences, the one to be minimized
+	price float32
+}
+
+// deliveryProblem is an input of the optimizer with sellers and cards turned into indices.
+type deliveryProblem struct {
+	cards   []string
+	sellers []string
+	// delivery is the policy of every seller
+	delivery []DeliveryPolicy
+	// thresholds is true if some seller has free shipping threshold, so buying at the cheapest offer is not always the best
+	thresholds bool
+	// offers contains all offers in stock for every card, sorted by price
+	offers [][]sellerOffer
+	// need is the number of copies to buy for every card: requested count limited by the total stock
+	need []int
+	// shortfalls is the number of requested copies nobody has
+	shortfalls map[string]int
+	// maxSellers limits the number of sellers in the plan if positive
+	maxSellers int
+	// weights and must come from priorities of cards
+	weights []float64
+	must    []bool
+	// wanted is need before it is reduced to fit the money budget
+	wanted []int
+}
+
+// SellerLimitError tells that cards cannot be bought from as few sellers as requested.
+type SellerLimitError struct {
+	MaxSellers int
+	// Cards could not be bought even from the sellers covering most of the list
+	Cards []string
+}
+
+func (e *SellerLimitError) Error() string {
+	if len(e.Cards) == 0 {
+		return fmt.Sprintf("no plan with at most %d sellers has been found", e.MaxSellers)
+	}
+	return fmt.Sprintf("cannot buy all cards from at most %d sellers, not covered: %s", e.MaxSellers, strings.Join(e.Cards, ", "))
+}
+
+func newDeliveryProblem(req NamesRequest, rules *DeliveryRules, cards map[string]CardResult) *deliveryProblem {
+	p := &deliveryProblem{
+		shortfalls: make(map[string]int),
+		maxSellers: req.MaxSellers,
+	}
+	sellerIx := make(map[string]int)
+
+	for name := range req.Cards {
+		p.cards = append(p.cards, name)
+	}
+	sort.Strings(p.cards)
+
+	p.offers = make([][]sellerOffer, len(p.cards))
+	p.need = make([]int, len(p.cards))
+	p.weights = make([]float64, len(p.cards))
+	p.must = make([]bool, len(p.cards))
+	for ci, name := range p.cards {
+		prio := req.Priorities[name]
+		p.weights[ci] = prio.weight()
+		p.must[ci] = prio.Must
+
+		res := cards[name]
+		stock := 0
+		for _, cp := range res.Prices {
+			if cp.Quantity <= 0 {
+				continue
+			}
+			seller := cp.SellerFullName()
+			si, found := sellerIx[seller]
+			if !found {
+				si = len(p.sellers)
+				sellerIx[seller] = si
+				p.sellers = append(p.sellers, seller)
+				d := rules.policyFor(cp)
+				p.delivery = append(p.delivery, d)
+				if d.FreeFrom > 0 && d.Cost(0) > 0 {
+					p.thresholds = true
+				}
+			}
+			p.offers[ci] = append(p.offers[ci], sellerOffer{seller: si, offer: cp, price: req.Sellers.price(cp)})
+			stock += cp.Quantity
+		}
+		sort.SliceStable(p.offers[ci], func(i, j int) bool {
+			return p.offers[ci][i].price < p.offers[ci][j].price
+		})
+
+		p.need[ci] = req.Cards[name]
+		if stock < p.need[ci] {
+			p.shortfalls[name] = p.need[ci] - stock
+			p.need[ci] = stock
+			logger.Debugw("not enough copies in stock",
+				"card", name,
+				"requested", req.Cards[name],
+				"stock", stock)
+		}
+	}
+	p.wanted = append([]int(nil), p.need...)
+	return p
+}
+
+// take is a number of copies bought from an offer.
+type take struct {
+	offer    int
+	quantity int
+}
+
+// assignment lists the offers used for every card.
+type assignment [][]take
+
+// assign buys the needed copies of every card from the cheapest offers of allowed sellers.
+// Once the set of sellers is fixed, there is no reason to pay more for any copy, so it is the cheapest way.
+// The assignment is not complete if allowed sellers do not have enough copies.
+func (p *deliveryProblem) assign(allowed []bool) (assignment, bool) {
+	a := make(assignment, len(p.cards))
+	complete := true
+	for ci, offers := range p.offers {
+		left := p.need[ci]
+		for oi, o := range offers {
+			if left == 0 {
+				break
+			}
+			if !allowed[o.seller] {
+				continue
+			}
+			n := o.offer.Quantity
+			if n > left {
+				n = left
+			}
+			a[ci] = append(a[ci], take{offer: oi, quantity: n})
+			left -= n
+		}
+		if left > 0 {
+			complete = false
+		}
+	}
+	return a, complete
+}
+
+// subtotals returns the actual price of cards bought from every seller used.
+func (p *deliveryProblem) subtotals(a assignment) map[int]float32 {
+	result := make(map[int]float32)
+	for ci, takes := range a {
+		for _, t := range takes {
+			o := p.offers[ci][t.offer]
+			result[o.seller] += o.offer.Price * float32(t.quantity)
+		}
+	}
+	return result
+}
+
+// cost is the weighted price of the assignment including delivery of every seller used.
+func (p *deliveryProblem) cost(a assignment) float64 {
+	total := 0.0
+	for ci, takes := range a {
+		for _, t := range takes {
+			total += float64(p.offers[ci][t.offer].price) * float64(t.quantity)
+		}
+	}
+	for si, subtotal := range p.subtotals(a) {
+		total += float64(p.delivery[si].Cost(subtotal))
+	}
+	return total
+}
+
+// withinLimit checks that the assignment uses not more than maxSellers sellers.
+func (p *deliveryProblem) withinLimit(a assignment) bool {
+	return p.maxSellers <= 0 || len(p.subtotals(a)) <= p.maxSellers
+}
+
+// quantities turns the assignment into the number of copies bought from every offer.
+func (p *deliveryProblem) quantities(a assignment) [][]int {
+	q := make([][]int, len(p.cards))
+	for ci, takes := range a {
+		q[ci] = make([]int, len(p.offers[ci]))
+		for _, t := range takes {
+			q[ci][t.offer] = t.quantity
+		}
+	}
+	return q
+}
+
+func (p *deliveryProblem) fromQuantities(q [][]int) assignment {
+	a := make(assignment, len(p.cards))
+	for ci := range q {
+		for oi, n := range q[ci] {
+			if n > 0 {
+				a[ci] = append(a[ci], take{offer: oi, quantity: n})
+			}
+		}
+	}
+	return a
+}
+
+// reachThresholds moves copies to allowed sellers which are short of free shipping, as long as it makes the assignment cheaper.
+// Once ctx is done it returns the cheapest assignment reached so far.
+func (p *deliveryProblem) reachThresholds(ctx context.Context, a assignment, allowed []bool) assignment {
+	if !p.thresholds {
+		return a
+	}
+	bestCost := p.cost(a)
+	for improved := true; improved; {
+		improved = false
+		for si, d := range p.delivery {
+			if !allowed[si] || d.FreeFrom <= 0 || d.Cost(0) == 0 {
+				continue
+			}
+			if ctx.Err() != nil {
+				return a
+			}
+			candidate, reached := p.fillSeller(a, si)
+			if !reached {
+				continue
+			}
+			if c := p.cost(candidate); c < bestCost {
+				a, bestCost = candidate, c
+				improved = true
+			}
+		}
+	}
+	return a
+}
+
+// fillSeller moves copies bought elsewhere to seller si one by one, choosing the cheapest move every time,
+// until the seller's free shipping threshold is reached.
+func (p *deliveryProblem) fillSeller(a assignment, si int) (assignment, bool) {
+	q := p.quantities(a)
+	subtotal := p.subtotals(a)[si]
+	for subtotal < p.delivery[si].FreeFrom {
+		bestCI, bestTo, bestFrom := -1, -1, -1
+		var bestDelta float32
+		for ci, offers := range p.offers {
+			// the cheapest offer of si with copies left and the most expensive copy bought elsewhere
+			to, from := -1, -1
+			for oi, o := range offers {
+				if o.seller == si {
+					if to < 0 && q[ci][oi] < o.offer.Quantity {
+						to = oi
+					}
+				} else if q[ci][oi] > 0 {
+					from = oi
+				}
+			}
+			if to < 0 || from < 0 {
+				continue
+			}
+			delta := offers[to].price - offers[from].price
+			if bestCI < 0 || delta < bestDelta {
+				bestCI, bestTo, bestFrom, bestDelta = ci, to, from, delta
+			}
+		}
+		if bestCI < 0 {
+			return nil, false
+		}
+		q[bestCI][bestTo]++
+		q[bestCI][bestFrom]--
+		subtotal += p.offers[bestCI][bestTo].offer.Price
+	}
+	return p.fromQuantities(q), true
+}
+
+func (p *deliveryProblem) plan(a assignment, optimal bool) *PurchasePlan {
+	orders := make(map[int]*SellerOrder)
+	for ci, takes := range a {
+		for _, t := range takes {
+			o := p.offers[ci][t.offer]
+			order, found := orders[o.seller]
+			if !found {
+				order = &SellerOrder{
+					Seller: p.sellers[o.seller],
+				}
+				orders[o.seller] = order
+			}
+			item := PlanItem{Card: p.cards[ci], CardPrice: o.offer}
+			item.Quantity = t.quantity
+			order.Items = append(order.Items, item)
+			order.Subtotal += o.offer.Price * float32(t.quantity)
+		}
+	}
+
+	plan := &PurchasePlan{
+		Optimal: optimal,
+	}
+	if len(p.shortfalls) > 0 {
+		plan.Shortfalls = p.shortfalls
+	}
+	for ci, takes := range a {
+		bought := 0
+		for _, t := range takes {
+			bought += t.quantity
+		}
+		plan.Value += p.weights[ci] * float64(bought)
+		if bought < p.wanted[ci] {
+			if plan.Deferred == nil {
+				plan.Deferred = make(map[string]int)
+			}
+			plan.Deferred[p.cards[ci]] = p.wanted[ci] - bought
+		}
+	}
+	for si, order := range orders {
+		order.Delivery = p.delivery[si].Cost(order.Subtotal)
+		order.Total = order.Subtotal + order.Delivery
+		plan.CardsTotal += order.Subtotal
+		plan.DeliveryTotal += order.Delivery
+		plan.Sellers = append(plan.Sellers, *order)
+	}
+	plan.Total = plan.CardsTotal + plan.DeliveryTotal
+	plan.SellerCount = len(plan.Sellers)
+	sort.Slice(plan.Sellers, func(i, j int) bool {
+		return plan.Sellers[i].Seller < plan.Sellers[j].Seller
+	})
+	return plan
+}
+
+// planCandidates keeps the k cheapest assignments found so far, no two of them use the same set of sellers.
+type planCandidates struct {
+	k     int
+	items []planCandidate
+}
+
+type planCandidate struct {
+	a    assignment
+	cost float64
+	key  string
+}
+
+func newPlanCandidates(k int) *planCandidates {
+	if k < 1 {
+		k = 1
+	}
+	return &planCandidates{k: k}
+}
+
+// add keeps the assignment if it is among the k cheapest ones and tells if it has been kept.
+// Assignments exceeding maxSellers are ignored.
+func (c *planCandidates) add(p *deliveryProblem, a assignment, cost float64) bool {
+	if cost >= c.worst() || !p.withinLimit(a) {
+		return false
+	}
+	sellers := make([]int, 0)
+	for si := range p.subtotals(a) {
+		sellers = append(sellers, si)
+	}
+	sort.Ints(sellers)
+	key := fmt.Sprint(sellers)
+
+	for i, item := range c.items {
+		if item.key == key {
+			if cost >= item.cost {
+				return false
+			}
+			c.items = append(c.items[:i], c.items[i+1:]...)
+			break
+		}
+	}
+	i := sort.Search(len(c.items), func(i int) bool {
+		return c.items[i].cost > cost
+	})
+	c.items = append(c.items, planCandidate{})
+	copy(c.items[i+1:], c.items[i:])
+	c.items[i] = planCandidate{a: a, cost: cost, key: key}
+	if len(c.items) > c.k {
+		c.items = c.items[:c.k]
+	}
+	return true
+}
+
+// worst is the cost an assignment should beat to be kept.
+func (c *planCandidates) worst() float64 {
+	if len(c.items) < c.k {
+		return math.Inf(1)
+	}
+	return c.items[c.k-1].cost
+}
+
+// best is the cost of the cheapest assignment, infinite if there are none.
+func (c *planCandidates) best() float64 {
+	if len(c.items) == 0 {
+		return math.Inf(1)
+	}
+	return c.items[0].cost
+}
+
+// eliminateFewer starts with every seller allowed and keeps dropping the seller whose removal saves the most.
+// While there are more sellers than maxSellers, it drops the one whose removal costs the least.
+// The cost is infinite if the limit has not been met. It returns what it has got so far once ctx is done.
+// Every assignment tried is offered to top.
+func (p *deliveryProblem) eliminateFewer(ctx context.Context, top *planCandidates) (assignment, float64) {
+	allowed := make([]bool, len(p.sellers))
+	for i := range allowed {
+		allowed[i] = true
+	}
+	best, _ := p.assign(allowed)
+	best = p.reachThresholds(ctx, best, allowed)
+	bestCost := p.cost(best)
+	top.add(p, best, bestCost)
+
+	for ctx.Err() == nil {
+		var candidate assignment
+		candidateCost := bestCost
+		if !p.withinLimit(best) {
+			candidateCost = math.Inf(1)
+		}
+		candidateSeller := -1
+		for si := range p.sellers {
+			// a pass tries every seller, which is long with hundreds of them
+			if ctx.Err() != nil {
+				break
+			}
+			if !allowed[si] {
+				continue
+			}
+			allowed[si] = false
+			a, complete := p.assign(allowed)
+			if complete {
+				a = p.reachThresholds(ctx, a, allowed)
+			}
+			allowed[si] = true
+			if !complete {
+				continue
+			}
+			c := p.cost(a)
+			top.add(p, a, c)
+			if c < candidateCost {
+				candidate, candidateCost, candidateSeller = a, c, si
+			}
+		}
+		if candidateSeller < 0 {
+			break
+		}
+		allowed[candidateSeller] = false
+		best, bestCost = candidate, candidateCost
+		logger.Debugw("eliminate fewer dropped seller",
+			"seller", p.sellers[candidateSeller],
+			"cost", bestCost)
+	}
+	if !p.withinLimit(best) {
+		return best, math.Inf(1)
+	}
+	return best, bestCost
+}
+
+// deliverySolver is a branch-and-bound search over sets of sellers to buy from.
+// Every seller is either opened (its fee is paid) or closed; cards are bought at the cheapest opened seller.
+// The search is exact unless there are free shipping thresholds: then assignment within opened sellers is a heuristic.
+type deliverySolver struct {
+	ctx   context.Context
+	p     *deliveryProblem
+	order []int // sellers in the order of decisions
+
+	state []sellerState
+
+	top     *planCandidates
+	nodes   int
+	aborted bool
+}
+
+type sellerState int
+
+const (
+	sellerUndecided sellerState = iota
+	sellerOpened
+	sellerClosed
+)
+
+// solveExact runs branch-and-bound until it is finished, ctx is done or maxExactNodes are visited.
+// It returns true if top is proven to hold the cheapest assignments.
+func (p *deliveryProblem) solveExact(ctx context.Context, top *planCandidates) bool {
+	s := &deliverySolver{
+		ctx:   ctx,
+		p:     p,
+		state: make([]sellerState, len(p.sellers)),
+		top:   top,
+	}
+	p.eliminateFewer(ctx, top)
+
+	// sellers with many cheap cards first: good plans are found early and prune the rest
+	offered := make([]int, len(p.sellers))
+	for _, offers := range p.offers {
+		for _, o := range offers {
+			offered[o.seller]++
+		}
+	}
+	for si := range p.sellers {
+		s.order = append(s.order, si)
+	}
+	sort.SliceStable(s.order, func(i, j int) bool {
+		return offered[s.order[i]] > offered[s.order[j]]
+	})
+
+	s.branch(0, 0, 0)
+	logger.Debugw("delivery branch and bound finished",
+		"nodes", s.nodes,
+		"aborted", s.aborted,
+		"cost", top.best())
+	return !s.aborted && !p.thresholds
+}
+
+// bound is the lowest cost reachable from the current state: the lowest possible fees of opened sellers
+// plus the cheapest copies of every card among sellers which are not closed.
+// If full, no more sellers can be opened, so undecided ones are as good as closed.
+func (s *deliverySolver) bound(fees float64, full bool) (float64, bool) {
+	total := fees
+	for ci, offers := range s.p.offers {
+		left := s.p.need[ci]
+		for _, o := range offers {
+			if left == 0 {
+				break
+			}
+			if st := s.state[o.seller]; st == sellerClosed || (full && st == sellerUndecided) {
+				continue
+			}
+			n := o.offer.Quantity
+			if n > left {
+				n = left
+			}
+			total += float64(o.price) * float64(n)
+			left -= n
+		}
+		if left > 0 {
+			return math.Inf(1), false
+		}
+	}
+	return total, true
+}
+
+func (s *deliverySolver) branch(depth int, fees float64, opened int) {
+	s.nodes++
+	if s.nodes > maxExactNodes || (s.nodes%1024 == 0 && s.ctx.Err() != nil) {
+		s.aborted = true
+	}
+	if s.aborted {
+		return
+	}
+
+	full := s.p.maxSellers > 0 && opened >= s.p.maxSellers
+	lb, feasible := s.bound(fees, full)
+	if !feasible || lb >= s.top.worst() {
+		return
+	}
+
+	allowed := make([]bool, len(s.p.sellers))
+	for si, st := range s.state {
+		allowed[si] = st == sellerOpened
+	}
+	if a, complete := s.p.assign(allowed); complete {
+		a = s.p.reachThresholds(s.ctx, a, allowed)
+		s.top.add(s.p, a, s.p.cost(a))
+	}
+
+	if depth == len(s.order) || full {
+		return
+	}
+
+	si := s.order[depth]
+	s.state[si] = sellerOpened
+	s.branch(depth+1, fees+float64(s.p.delivery[si].minCost()), opened+1)
+	s.state[si] = sellerClosed
+	s.branch(depth+1, fees, opened)
+	s.state[si] = sellerUndecided
+}
+
+// evaluateConsideringDelivery finds the cheapest plans of buying requested copies of every card including delivery fees:
+// up to req.Alternatives plans with different sets of sellers, the cheapest first.
+// Copies of a card are split between sellers if nobody has enough; whatever is missing is reported in Shortfalls.
+// If plans do not fit req.Budget, the most valuable copies are chosen by fitBudget and the rest is reported in Deferred.
+// The search takes not longer than the plan budget of req and stops once ctx is done, returning the best plans found so far.
+// SellerLimitError is returned if no plan within req.MaxSellers has been found, BudgetError if must cards do not fit.
+func evaluateConsideringDelivery(ctx context.Context, req NamesRequest, rules *DeliveryRules, cards map[string]CardResult) ([]*PurchasePlan, error) {
+	p := newDeliveryProblem(req, rules, cards)
+	strategy := req.Strategy
+	if strategy == StrategyAuto {
+		strategy = StrategyExact
+		if len(p.sellers) > maxAutoExactSellers {
+			strategy = StrategyHeuristic
+		}
+	}
+	logger.Debugw("delivery problem built",
+		"cards", len(p.cards),
+		"sellers", len(p.sellers),
+		"strategy", strategy)
+
+	timeBudget := req.PlanBudget
+	if timeBudget <= 0 {
+		timeBudget = DefaultPlanBudget
+	}
+	planCtx, cancel := context.WithTimeout(ctx, timeBudget)
+	defer cancel()
+	firstCtx := planCtx
+	if req.Budget > 0 {
+		// leave time for fitting the list into the money budget
+		var cancelFirst context.CancelFunc
+		firstCtx, cancelFirst = context.WithTimeout(planCtx, timeBudget/2)
+		defer cancelFirst()
+	}
+
+	solve := func(ctx context.Context, k int) (*planCandidates, bool) {
+		top := newPlanCandidates(k)
+		switch strategy {
+		case StrategyExact:
+			return top, p.solveExact(ctx, top)
+		case StrategyHeuristic:
+			p.solveHeuristic(ctx, p.lowerBound(), top)
+		}
+		return top, false
+	}
+
+	top, proven := solve(firstCtx, req.Alternatives)
+	if len(top.items) == 0 {
+		return nil, &SellerLimitError{
+			MaxSellers: p.maxSellers,
+			Cards:      p.uncoveredCards(),
+		}
+	}
+	fitted := false
+	budget := float64(req.Budget)
+	if budget > 0 && p.realCost(top.items[0].a) > budget {
+		a, err := p.fitBudget(func(k int) *planCandidates {
+			top, _ := solve(planCtx, k)
+			return top
+		}, budget, top.items[0].a)
+		if err != nil {
+			return nil, err
+		}
+		all, _ := solve(planCtx, req.Alternatives)
+		top = newPlanCandidates(req.Alternatives)
+		top.add(p, a, p.cost(a))
+		for _, item := range all.items {
+			if p.realCost(item.a) <= budget {
+				top.add(p, item.a, item.cost)
+			}
+		}
+		// the subset of copies is chosen heuristically, so the plan is never proven to be the best one
+		fitted, proven = true, false
+	} else if budget > 0 {
+		// alternatives might be over the budget even if the best plan is not
+		all := top
+		top = newPlanCandidates(req.Alternatives)
+		for _, item := range all.items {
+			if p.realCost(item.a) <= budget {
+				top.add(p, item.a, item.cost)
+			}
+		}
+	}
+
+	lowerBound := p.lowerBound()
+	cost := top.best()
+	if !proven {
+		// the bound takes a fixed number of cheap steps, so it is not limited by the budget
+		if lb := p.lagrangianBound(ctx, cost); lb > lowerBound {
+			lowerBound = lb
+		}
+	}
+	if proven || cost <= lowerBound+boundEpsilon {
+		lowerBound = cost
+	}
+
+	plans := make([]*PurchasePlan, 0, len(top.items))
+	for i, item := range top.items {
+		// alternatives are proven only if the whole search has been finished
+		plan := p.plan(item.a, proven || (i == 0 && !fitted && cost <= lowerBound+boundEpsilon))
+		plan.LowerBound = float32(lowerBound)
+		plan.Strategy = strategy
+		plans = append(plans, plan)
+	}
+	logger.Debugw("delivery plans found",
+		"cost", cost,
+		"lower_bound", lowerBound,
+		"plans", len(plans),
+		"fitted", fitted,
+		"optimal", plans[0].Optimal)
+	return plans, nil
+}
+
+// uncoveredCards picks maxSellers sellers one by one, each time the one offering most of the copies still needed,
+// and returns cards which are not bought in full after that.
+func (p *deliveryProblem) uncoveredCards() []string {
+	left := append([]int(nil), p.need...)
+	picked := make([]bool, len(p.sellers))
+	for n := 0; n < p.maxSellers; n++ {
+		bestSeller, bestCopies := -1, 0
+		for si := range p.sellers {
+			if picked[si] {
+				continue
+			}
+			copies := 0
+			for ci, offers := range p.offers {
+				got := 0
+				for _, o := range offers {
+					if o.seller == si {
+						got += o.offer.Quantity
+					}
+				}
+				if got > left[ci] {
+					got = left[ci]
+				}
+				copies += got
+			}
+			if copies > bestCopies {
+				bestSeller, bestCopies = si, copies
+			}
+		}
+		if bestSeller < 0 {
+			break
+		}
+		picked[bestSeller] = true
+		for ci, offers := range p.offers {
+			for _, o := range offers {
+				if o.seller == bestSeller {
+					left[ci] -= o.offer.Quantity
+				}
+			}
+			if left[ci] < 0 {
+				left[ci] = 0
+			}
+		}
+	}
+
+	var result []string
+	for ci, n := range left {
+		if n > 0 {
+			result = append(result, p.cards[ci])
+		}
+	}
+	return result
+}
@@ -0,0 +1,249 @@
+package mtgbulk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// PlanStrategy chooses how the delivery-aware plan is searched for.
+type PlanStrategy string
+
+const (
+	// StrategyAuto uses the exact search for short lists of sellers and the heuristic one otherwise
+	StrategyAuto PlanStrategy = ""
+	// StrategyExact is branch-and-bound which proves the plan to be the cheapest if it finishes in time
+	StrategyExact PlanStrategy = "exact"
+	// StrategyHeuristic is local search which keeps improving the plan until the budget is spent
+	StrategyHeuristic PlanStrategy = "heuristic"
+)
+
+// ParsePlanStrategy checks that s is a known strategy, an empty string means StrategyAuto.
+func ParsePlanStrategy(s string) (PlanStrategy, error) {
+	strategy := PlanStrategy(s)
+	return strategy, strategy.validate()
+}
+
+func (s PlanStrategy) validate() error {
+	switch s {
+	case StrategyAuto, StrategyExact, StrategyHeuristic:
+		return nil
+	}
+	return fmt.Errorf("unknown plan strategy %q", s)
+}
+
+// DefaultPlanBudget limits the time spent on the delivery-aware plan if NamesRequest has no budget.
+const DefaultPlanBudget = 10 * time.Second
+
+const (
+	// maxAutoExactSellers is the number of sellers up to which StrategyAuto goes for the exact search
+	maxAutoExactSellers = 25
+	// maxIdleMoves stops the local search if the best plan has not been improved for so long
+	maxIdleMoves = 20000
+	// lagrangianSteps is the number of subgradient steps made to tighten the lower bound
+	lagrangianSteps = 300
+	boundEpsilon    = 1e-3
+)
+
+// lowerBound is the cost no plan can go below: every copy at its cheapest price
+// plus the lowest fees of sellers which cannot be avoided because nobody else has enough copies.
+func (p *deliveryProblem) lowerBound() float64 {
+	total := 0.0
+	forced := make(map[int]bool)
+	for ci, offers := range p.offers {
+		stock := 0
+		bySeller := make(map[int]int)
+		left := p.need[ci]
+		for _, o := range offers {
+			stock += o.offer.Quantity
+			bySeller[o.seller] += o.offer.Quantity
+			n := o.offer.Quantity
+			if n > left {
+				n = left
+			}
+			total += float64(o.price) * float64(n)
+			left -= n
+		}
+		if p.need[ci] == 0 {
+			continue
+		}
+		for si, n := range bySeller {
+			if stock-n < p.need[ci] {
+				forced[si] = true
+			}
+		}
+	}
+	for si := range forced {
+		total += float64(p.delivery[si].minCost())
+	}
+	return total
+}
+
+// lagrangianBound tightens the lower bound by relaxing the requirement to buy every card.
+// With a price lambda paid for every card not bought, sellers are independent: a seller is used only if
+// the copies cheaper than lambda save more than its lowest fee. Any lambda gives a valid bound,
+// subgradient steps towards the upper bound look for the best one.
+func (p *deliveryProblem) lagrangianBound(ctx context.Context, upper float64) float64 {
+	lambda := make([]float64, len(p.cards))
+	for ci, offers := range p.offers {
+		// the price of the most expensive copy among the cheapest ones makes the bound equal to the trivial one
+		left := p.need[ci]
+		for _, o := range offers {
+			if left <= 0 {
+				break
+			}
+			lambda[ci] = float64(o.price)
+			left -= o.offer.Quantity
+		}
+	}
+
+	bought := make([]float64, len(p.cards))
+	saving := make([]float64, len(p.sellers))
+	evaluate := func() float64 {
+		total := 0.0
+		for ci := range p.cards {
+			total += lambda[ci] * float64(p.need[ci])
+			bought[ci] = 0
+		}
+		for si, d := range p.delivery {
+			saving[si] = float64(d.minCost())
+		}
+		for ci, offers := range p.offers {
+			for _, o := range offers {
+				if d := float64(o.price) - lambda[ci]; d < 0 {
+					saving[o.seller] += d * float64(offerCap(o, p.need[ci]))
+				}
+			}
+		}
+		for si := range p.sellers {
+			if saving[si] < 0 {
+				total += saving[si]
+			}
+		}
+		for ci, offers := range p.offers {
+			for _, o := range offers {
+				if saving[o.seller] < 0 && float64(o.price) < lambda[ci] {
+					bought[ci] += float64(offerCap(o, p.need[ci]))
+				}
+			}
+		}
+		return total
+	}
+
+	best := evaluate()
+	theta := 1.0
+	sinceImproved := 0
+	for step := 0; step < lagrangianSteps && ctx.Err() == nil; step++ {
+		norm := 0.0
+		for ci := range p.cards {
+			g := float64(p.need[ci]) - bought[ci]
+			norm += g * g
+		}
+		if norm == 0 || upper-best <= boundEpsilon {
+			break
+		}
+		stepSize := theta * (upper - best) / norm
+		for ci := range p.cards {
+			lambda[ci] += stepSize * (float64(p.need[ci]) - bought[ci])
+			if lambda[ci] < 0 {
+				lambda[ci] = 0
+			}
+		}
+		if v := evaluate(); v > best {
+			best = v
+			sinceImproved = 0
+		} else if sinceImproved++; sinceImproved >= 20 {
+			theta /= 2
+			sinceImproved = 0
+		}
+	}
+	return best
+}
+
+// offerCap is the number of copies of the offer which can be useful.
+func offerCap(o sellerOffer, need int) int {
+	if o.offer.Quantity < need {
+		return o.offer.Quantity
+	}
+	return need
+}
+
+// solveHeuristic starts with eliminateFewer and improves it by simulated annealing over sets of allowed sellers:
+// a move opens or closes one or two random sellers, worse sets are accepted with a chance decreasing over time.
+// Sets with more than maxSellers sellers are penalized, so the search can get out of them, but they are never the result.
+// It stops once ctx is done, the best plan reaches lowerBound or top has not been changed for maxIdleMoves.
+// Every feasible assignment tried is offered to top.
+func (p *deliveryProblem) solveHeuristic(ctx context.Context, lowerBound float64, top *planCandidates) {
+	best, _ := p.eliminateFewer(ctx, top)
+	if len(p.sellers) < 2 {
+		return
+	}
+
+	allowed := make([]bool, len(p.sellers))
+	for si := range p.subtotals(best) {
+		allowed[si] = true
+	}
+
+	// the temperature starts at an average fee: closing a seller usually saves about that much
+	start := time.Now()
+	deadline, _ := ctx.Deadline()
+	total := deadline.Sub(start)
+	t0 := 0.0
+	for _, d := range p.delivery {
+		t0 += float64(d.Fee)
+	}
+	t0 = t0/float64(len(p.delivery)) + 1
+	penalized := func(a assignment) float64 {
+		c := p.cost(a)
+		if extra := len(p.subtotals(a)) - p.maxSellers; p.maxSellers > 0 && extra > 0 {
+			c += float64(extra) * 2 * t0
+		}
+		return c
+	}
+	current := penalized(best)
+
+	rng := rand.New(rand.NewSource(1))
+	moves := 0
+	for idle := 0; idle < maxIdleMoves && (top.k > 1 || top.best() > lowerBound+boundEpsilon); idle++ {
+		moves++
+		// a move is slow with hundreds of sellers having free shipping thresholds
+		if ctx.Err() != nil {
+			break
+		}
+
+		toggled := []int{rng.Intn(len(p.sellers))}
+		if rng.Intn(2) == 0 {
+			toggled = append(toggled, rng.Intn(len(p.sellers)))
+		}
+		for _, si := range toggled {
+			allowed[si] = !allowed[si]
+		}
+
+		accepted := false
+		if a, complete := p.assign(allowed); complete {
+			a = p.reachThresholds(ctx, a, allowed)
+			c := penalized(a)
+			temperature := t0
+			if total > 0 {
+				temperature *= 1 - float64(time.Since(start))/float64(total)
+			}
+			if c <= current || (temperature > 0 && rng.Float64() < math.Exp((current-c)/temperature)) {
+				accepted = true
+				current = c
+			}
+			if top.add(p, a, c) {
+				idle = 0
+			}
+		}
+		if !accepted {
+			for i := len(toggled) - 1; i >= 0; i-- {
+				allowed[toggled[i]] = !allowed[toggled[i]]
+			}
+		}
+	}
+	logger.Debugw("delivery local search finished",
+		"moves", moves,
+		"cost", top.best())
+}
@@ -0,0 +1,73 @@
+package mtgbulk
+
+import "fmt"
+
+// DeliveryPolicy tells how much a seller charges for delivering an order.
+type DeliveryPolicy struct {
+	// Fee is charged for every order unless it is free by FreeFrom or Pickup
+	Fee float32 `json:"fee"`
+	// FreeFrom is the order subtotal starting from which delivery is free. Never free if 0
+	FreeFrom float32 `json:"free_from"`
+	// Pickup means the order is collected in person, so delivery costs nothing
+	Pickup bool `json:"pickup"`
+}
+
+// Cost returns the delivery price of an order with the given subtotal.
+func (d DeliveryPolicy) Cost(subtotal float32) float32 {
+	if d.Pickup || (d.FreeFrom > 0 && subtotal >= d.FreeFrom) {
+		return 0
+	}
+	return d.Fee
+}
+
+// minCost is the cheapest delivery possible with this policy whatever is bought.
+func (d DeliveryPolicy) minCost() float32 {
+	if d.Pickup || d.FreeFrom > 0 {
+		return 0
+	}
+	return d.Fee
+}
+
+func (d DeliveryPolicy) validate() error {
+	if d.Fee < 0 || d.FreeFrom < 0 {
+		return fmt.Errorf("delivery fee and free shipping threshold cannot be negative: %+v", d)
+	}
+	return nil
+}
+
+// DeliveryRules chooses the policy of every seller: a seller's own policy goes first, then the policy of its platform,
+// then Default.
+type DeliveryRules struct {
+	Default DeliveryPolicy `json:"default"`
+	// Platforms is keyed by platform name, e.g. "MtgSale"
+	Platforms map[string]DeliveryPolicy `json:"platforms"`
+	// Sellers is keyed by full seller name, e.g. "mtgsale" or "trader@TopDeck"
+	Sellers map[string]DeliveryPolicy `json:"sellers"`
+}
+
+func (r *DeliveryRules) policyFor(cp CardPrice) DeliveryPolicy {
+	if d, found := r.Sellers[cp.SellerFullName()]; found {
+		return d
+	}
+	if d, found := r.Platforms[cp.Platform.String()]; found {
+		return d
+	}
+	return r.Default
+}
+
+func (r *DeliveryRules) Validate() error {
+	if err := r.Default.validate(); err != nil {
+		return err
+	}
+	for name, d := range r.Platforms {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("platform %q: %w", name, err)
+		}
+	}
+	for name, d := range r.Sellers {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("seller %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package mtgbulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testOffer is a copy of a card sold by a trader of MtgTrade
+type testOffer struct {
+	seller   string
+	price    float32
+	quantity int
+}
+
+func testCards(offers map[string][]testOffer) map[string]CardResult {
+	cards := make(map[string]CardResult, len(offers))
+	for name, list := range offers {
+		res := CardResult{Available: len(list) > 0}
+		for _, o := range list {
+			res.Prices = append(res.Prices, CardPrice{Price: o.price, Quantity: o.quantity, Platform: MtgTrade, Trader: o.seller})
+		}
+		cards[name] = res
+	}
+	return cards
+}
+
+func testSeller(name string) string {
+	return name + "@" + MtgTrade.String()
+}
+
+// cheapestPlan tries every way of buying needed copies within the seller limit and returns the lowest cost,
+// infinite if there is no way.
+func cheapestPlan(p *deliveryProblem) float64 {
+	best := math.Inf(1)
+	a := make(assignment, len(p.cards))
+	var buy func(ci, oi, left int)
+	buy = func(ci, oi, left int) {
+		if ci == len(p.cards) {
+			if p.withinLimit(a) && p.cost(a) < best {
+				best = p.cost(a)
+			}
+			return
+		}
+		if left == 0 {
+			next := 0
+			if ci+1 < len(p.cards) {
+				next = p.need[ci+1]
+			}
+			buy(ci+1, 0, next)
+			return
+		}
+		if oi == len(p.offers[ci]) {
+			return
+		}
+		for n := 0; n <= p.offers[ci][oi].offer.Quantity && n <= left; n++ {
+			if n > 0 {
+				a[ci] = append(a[ci], take{offer: oi, quantity: n})
+			}
+			buy(ci, oi+1, left-n)
+			if n > 0 {
+				a[ci] = a[ci][:len(a[ci])-1]
+			}
+		}
+	}
+	if len(p.cards) > 0 {
+		buy(0, 0, p.need[0])
+	}
+	return best
+}
+
+// subsetPlans buys every copy at the cheapest offer of every subset of sellers and returns the lowest cost
+// of every set of sellers used within the limit, the cheapest first. These are the alternatives.
+func subsetPlans(p *deliveryProblem) []float64 {
+	best := make(map[string]float64)
+	for set := 1; set < 1<<len(p.sellers); set++ {
+		allowed := make([]bool, len(p.sellers))
+		for si := range allowed {
+			allowed[si] = set&(1<<si) != 0
+		}
+		a, complete := p.assign(allowed)
+		if !complete || !p.withinLimit(a) {
+			continue
+		}
+		used := make([]int, 0)
+		for si := range p.subtotals(a) {
+			used = append(used, si)
+		}
+		sort.Ints(used)
+		key := fmt.Sprint(used)
+		if c, found := best[key]; !found || p.cost(a) < c {
+			best[key] = p.cost(a)
+		}
+	}
+	costs := make([]float64, 0, len(best))
+	for _, c := range best {
+		costs = append(costs, c)
+	}
+	sort.Float64s(costs)
+	return costs
+}
+
+func planSellers(plan *PurchasePlan) string {
+	sellers := make([]string, 0, len(plan.Sellers))
+	for _, o := range plan.Sellers {
+		sellers = append(sellers, o.Seller)
+	}
+	return fmt.Sprint(sellers)
+}
+
+// checkPlans compares plans with the brute force. Without thresholds the exact solver has to find the cheapest plan
+// and the cheapest alternatives, otherwise plans are heuristic but never beat the brute force or have the bound above it.
+func checkPlans(t *testing.T, req NamesRequest, rules *DeliveryRules, cards map[string]CardResult) {
+	t.Helper()
+	p := newDeliveryProblem(req, rules, cards)
+	best := cheapestPlan(p)
+	plans, err := evaluateConsideringDelivery(context.Background(), req, rules, cards)
+	if math.IsInf(best, 1) {
+		var limitErr *SellerLimitError
+		if !errors.As(err, &limitErr) {
+			t.Fatalf("SellerLimitError is expected, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	exact := req.Strategy == StrategyExact && !p.thresholds
+	if total := float64(plans[0].Total); total < best-0.01 || ((exact || plans[0].Optimal) && total > best+0.01) {
+		t.Errorf("the plan costs %v, the cheapest one costs %v", total, best)
+	}
+	if float64(plans[0].LowerBound) > best+0.01 {
+		t.Errorf("lower bound %v is above the cheapest plan %v", plans[0].LowerBound, best)
+	}
+	seen := make(map[string]bool)
+	for i, plan := range plans {
+		if seen[planSellers(plan)] {
+			t.Errorf("plan %d repeats sellers %s", i, planSellers(plan))
+		}
+		seen[planSellers(plan)] = true
+		if req.MaxSellers > 0 && plan.SellerCount > req.MaxSellers {
+			t.Errorf("plan %d has %d sellers, the limit is %d", i, plan.SellerCount, req.MaxSellers)
+		}
+		if float64(plan.Total) < best-0.01 {
+			t.Errorf("plan %d costs %v which is below the cheapest plan %v", i, plan.Total, best)
+		}
+		if plan.Strategy != req.Strategy {
+			t.Errorf("plan %d is made by %q, %q is expected", i, plan.Strategy, req.Strategy)
+		}
+	}
+	if !exact {
+		return
+	}
+
+	want := subsetPlans(p)
+	if k := req.Alternatives; len(want) > k && k > 0 {
+		want = want[:k]
+	} else if k <= 0 {
+		want = want[:1]
+	}
+	if len(plans) != len(want) {
+		t.Fatalf("%d plans are expected, got %d", len(want), len(plans))
+	}
+	for i, plan := range plans {
+		if math.Abs(float64(plan.Total)-want[i]) > 0.01 {
+			t.Errorf("plan %d costs %v, %v is expected", i, plan.Total, want[i])
+		}
+	}
+}
+
+func TestDeliveryPlansMatchBruteForce(t *testing.T) {
+	tests := []struct {
+		name   string
+		cards  map[string]int
+		offers map[string][]testOffer
+		rules  DeliveryRules
+		max    int
+		alts   int
+	}{
+		{
+			name:  "one seller saves the fee",
+			cards: map[string]int{"Lightning Bolt": 1, "Counterspell": 1},
+			offers: map[string][]testOffer{
+				"Lightning Bolt": {{"a", 10, 1}, {"b", 15, 1}},
+				"Counterspell":   {{"b", 20, 1}, {"a", 30, 1}},
+			},
+			rules: DeliveryRules{Default: DeliveryPolicy{Fee: 100}},
+			alts:  3,
+		},
+		{
+			name:  "copies are split when nobody has enough",
+			cards: map[string]int{"Lightning Bolt": 3},
+			offers: map[string][]testOffer{
+				"Lightning Bolt": {{"a", 10, 2}, {"b", 12, 2}, {"c", 11, 1}},
+			},
+			rules: DeliveryRules{Default: DeliveryPolicy{Fee: 5}},
+			alts:  3,
+		},
+		{
+			name:  "free shipping threshold",
+			cards: map[string]int{"Lightning Bolt": 2, "Counterspell": 1},
+			offers: map[string][]testOffer{
+				"Lightning Bolt": {{"a", 10, 2}, {"b", 12, 2}},
+				"Counterspell":   {{"a", 20, 1}, {"b", 25, 1}},
+			},
+			rules: DeliveryRules{
+				Default: DeliveryPolicy{Fee: 30},
+				Sellers: map[string]DeliveryPolicy{testSeller("b"): {Fee: 30, FreeFrom: 45}},
+			},
+			alts: 2,
+		},
+		{
+			name:  "pickup is free",
+			cards: map[string]int{"Lightning Bolt": 1, "Counterspell": 1},
+			offers: map[string][]testOffer{
+				"Lightning Bolt": {{"a", 10, 1}, {"b", 11, 1}},
+				"Counterspell":   {{"a", 10, 1}, {"c", 5, 1}},
+			},
+			rules: DeliveryRules{
+				Default: DeliveryPolicy{Fee: 50},
+				Sellers: map[string]DeliveryPolicy{testSeller("c"): {Pickup: true}},
+			},
+			alts: 3,
+		},
+		{
+			name:  "seller limit",
+			cards: map[string]int{"Lightning Bolt": 1, "Counterspell": 1, "Shock": 1},
+			offers: map[string][]testOffer{
+				"Lightning Bolt": {{"a", 10, 1}, {"b", 1, 1}},
+				"Counterspell":   {{"b", 10, 1}, {"c", 1, 1}},
+				"Shock":          {{"c", 10, 1}, {"a", 1, 1}},
+			},
+			rules: DeliveryRules{Default: DeliveryPolicy{Fee: 1}},
+			max:   2,
+			alts:  4,
+		},
+	}
+	for _, strategy := range []PlanStrategy{StrategyExact, StrategyHeuristic} {
+		for _, tt := range tests {
+			tt, strategy := tt, strategy
+			t.Run(string(strategy)+"/"+tt.name, func(t *testing.T) {
+				rules := tt.rules
+				req := NamesRequest{
+					Cards:        tt.cards,
+					Strategy:     strategy,
+					MaxSellers:   tt.max,
+					Alternatives: tt.alts,
+					PlanBudget:   5 * time.Second,
+				}
+				checkPlans(t, req, &rules, testCards(tt.offers))
+			})
+		}
+	}
+}
+
+func TestDeliveryPlansMatchBruteForceRandomly(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	names := []string{"Lightning Bolt", "Counterspell", "Shock"}
+	sellers := []string{"a", "b", "c", "d"}
+	for i := 0; i < 200; i++ {
+		cards := make(map[string]int)
+		offers := make(map[string][]testOffer)
+		for _, name := range names {
+			cards[name] = 1 + rnd.Intn(2)
+			for _, s := range sellers {
+				if rnd.Intn(3) > 0 {
+					offers[name] = append(offers[name], testOffer{s, float32(1 + rnd.Intn(30)), 1 + rnd.Intn(2)})
+				}
+			}
+		}
+		rules := DeliveryRules{
+			Default: DeliveryPolicy{Fee: float32(rnd.Intn(40))},
+			Sellers: make(map[string]DeliveryPolicy),
+		}
+		for _, s := range sellers {
+			if rnd.Intn(4) == 0 {
+				rules.Sellers[testSeller(s)] = DeliveryPolicy{Fee: float32(rnd.Intn(40)), FreeFrom: float32(rnd.Intn(60))}
+			}
+		}
+		maxSellers, alts := rnd.Intn(4), rnd.Intn(4)
+		for _, strategy := range []PlanStrategy{StrategyExact, StrategyHeuristic} {
+			req := NamesRequest{
+				Cards:        cards,
+				Strategy:     strategy,
+				MaxSellers:   maxSellers,
+				Alternatives: alts,
+				PlanBudget:   5 * time.Second,
+			}
+			t.Run(fmt.Sprintf("%s/%d", strategy, i), func(t *testing.T) {
+				checkPlans(t, req, &rules, testCards(offers))
+			})
+		}
+	}
+}
+
+func TestDeliveryReportsCardsBeyondSellerLimit(t *testing.T) {
+	req := NamesRequest{
+		Cards:      map[string]int{"Lightning Bolt": 1, "Shock": 1, "Counterspell": 1},
+		Strategy:   StrategyExact,
+		MaxSellers: 1,
+	}
+	cards := testCards(map[string][]testOffer{
+		"Lightning Bolt": {{"a", 10, 1}},
+		"Shock":          {{"a", 10, 1}},
+		"Counterspell":   {{"b", 10, 1}},
+	})
+	_, err := evaluateConsideringDelivery(context.Background(), req, &DeliveryRules{}, cards)
+	var limitErr *SellerLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("SellerLimitError is expected, got %v", err)
+	}
+	if limitErr.MaxSellers != 1 || !reflect.DeepEqual(limitErr.Cards, []string{"Counterspell"}) {
+		t.Errorf("Counterspell is expected to be reported, got %+v", limitErr)
+	}
+}
+
+func TestHeuristicPlanKeepsTimeBudget(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	cards := make(map[string]int)
+	offers := make(map[string][]testOffer)
+	for c := 0; c < 150; c++ {
+		name := fmt.Sprintf("card %d", c)
+		cards[name] = 1 + rnd.Intn(4)
+		for s := 0; s < 400; s++ {
+			if rnd.Intn(5) == 0 {
+				offers[name] = append(offers[name], testOffer{fmt.Sprint(s), float32(1 + rnd.Intn(100)), 1 + rnd.Intn(4)})
+			}
+		}
+	}
+	// free shipping thresholds make every move of the local search slow
+	rules := &DeliveryRules{Default: DeliveryPolicy{Fee: 30, FreeFrom: 300}}
+	budget := 200 * time.Millisecond
+	req := NamesRequest{Cards: cards, Strategy: StrategyHeuristic, PlanBudget: budget}
+
+	start := time.Now()
+	plans, err := evaluateConsideringDelivery(context.Background(), req, rules, testCards(offers))
+	if elapsed := time.Since(start); elapsed > 2*budget+500*time.Millisecond {
+		t.Errorf("the plan budget is %s, the search has taken %s", budget, elapsed)
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if plans[0].LowerBound > plans[0].Total || plans[0].LowerBound <= 0 {
+		t.Errorf("lower bound %v is expected to be positive and below the total %v", plans[0].LowerBound, plans[0].Total)
+	}
+}
@@ -0,0 +1,104 @@
+package mtgbulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gocolly/colly"
+)
+
+type SearchStatus string
+
+const (
+	SearchOK        SearchStatus = "ok"
+	SearchFailed    SearchStatus = "failed"
+	SearchCancelled SearchStatus = "cancelled"
+	// SearchSkipped means the search has not been started because the request was cancelled before
+	SearchSkipped SearchStatus = "skipped"
+)
+
+// SearchDiagnostics describes how a search of a single card at a single platform went.
+type SearchDiagnostics struct {
+	Platform string
+	Status   SearchStatus
+	// HTTPCode is the worst HTTP status code received, 0 if no response has been received
+	HTTPCode int
+	// RowsParsed is the number of offers which have been parsed successfully
+	RowsParsed int
+	// RowsSkipped is the number of offers which have been dropped due to parse errors
+	RowsSkipped int
+	// Cached is true if the result has been taken from a cache instead of the platform
+	Cached bool   `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+func newSearchDiagnostics(platform string) *SearchDiagnostics {
+	return &SearchDiagnostics{
+		Platform: platform,
+		Status:   SearchOK,
+	}
+}
+
+// Complete is true if the search has finished successfully without dropping any offer or page.
+func (d SearchDiagnostics) Complete() bool {
+	return d.Status == SearchOK && d.RowsSkipped == 0 && d.HTTPCode < 400
+}
+
+func (d *SearchDiagnostics) setError(err error) {
+	if err == nil {
+		return
+	}
+	d.Error = err.Error()
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		d.Status = SearchCancelled
+	} else {
+		d.Status = SearchFailed
+	}
+}
+
+// trackResponses records status codes of all responses received by c. A failed request fails the search
+// even if it is not the first page.
+func (d *SearchDiagnostics) trackResponses(c *colly.Collector) {
+	c.OnResponse(func(r *colly.Response) {
+		if r.StatusCode > d.HTTPCode {
+			d.HTTPCode = r.StatusCode
+		}
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r != nil && r.StatusCode > d.HTTPCode {
+			d.HTTPCode = r.StatusCode
+		}
+		if r != nil && r.Request != nil {
+			err = fmt.Errorf("unable to visit %s: %w", r.Request.URL, err)
+		}
+		d.setError(err)
+	})
+}
+
+// finishSearch attaches diagnostics to the result and converts an error of visiting addr into the search error.
+func finishSearch(ctx context.Context, result CardResult, diag *SearchDiagnostics, addr string, err error) (CardResult, error) {
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	} else if err != nil {
+		err = fmt.Errorf("unable to visit %s: %w", addr, err)
+	} else if diag.Status == SearchFailed {
+		// the first page is fine but a following one has failed
+		err = errors.New(diag.Error)
+	}
+	diag.setError(err)
+	result.Diagnostics = append(result.Diagnostics, *diag)
+	return result, err
+}
+
+// Incomplete is true if at least one search has failed, has been cancelled or has dropped some offers.
+func (r *NamesResult) Incomplete() bool {
+	for _, diags := range r.Diagnostics {
+		for _, d := range diags {
+			if !d.Complete() {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package mtgbulk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+type HTTPMode string
+
+const (
+	// HTTPModeLive sends requests to the network as usual
+	HTTPModeLive HTTPMode = ""
+	// HTTPModeRecord sends requests to the network and stores every exchange as a fixture
+	HTTPModeRecord HTTPMode = "record"
+	// HTTPModeReplay serves stored fixtures and never touches the network
+	HTTPModeReplay HTTPMode = "replay"
+)
+
+// fixture is the metadata of a recorded exchange. The body is stored next to it as is,
+// so recorded pages can be inspected and edited by hand.
+type fixture struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Header     http.Header
+}
+
+func fixturePath(dir string, req *http.Request) string {
+	sum := sha1.Sum([]byte(req.Method + " " + req.URL.String()))
+	return filepath.Join(dir, req.URL.Host, hex.EncodeToString(sum[:]))
+}
+
+// RecordingTransport passes requests to Base and stores every exchange in Dir.
+type RecordingTransport struct {
+	Dir string
+	// Base is used to send requests. http.DefaultTransport is used if nil
+	Base http.RoundTripper
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := t.store(req, resp, body); err != nil {
+		logger.Errorw("could not record fixture",
+			"url", req.URL.String(),
+			"err", err)
+	}
+	return resp, nil
+}
+
+func (t *RecordingTransport) store(req *http.Request, resp *http.Response, body []byte) error {
+	path := fixturePath(t.Dir, req)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	meta, err := json.MarshalIndent(fixture{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".body", body, 0640); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path+".json", meta, 0640)
+}
+
+// ReplayTransport serves exchanges recorded by RecordingTransport from Dir.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := fixturePath(t.Dir, req)
+	meta, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("no recorded response for %s %s: %w", req.Method, req.URL, err)
+	}
+	var fx fixture
+	if err := json.Unmarshal(meta, &fx); err != nil {
+		return nil, fmt.Errorf("broken fixture %s: %w", path, err)
+	}
+	body, err := ioutil.ReadFile(path + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("no recorded body for %s %s: %w", req.Method, req.URL, err)
+	}
+
+	header := fx.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	// the body is stored decoded, whatever the original encoding was
+	header.Del("Content-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fx.StatusCode, http.StatusText(fx.StatusCode)),
+		StatusCode:    fx.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// withHTTPMode wraps base according to mode so that exchanges are recorded to or replayed from dir.
+func withHTTPMode(mode HTTPMode, dir string, base http.RoundTripper) (http.RoundTripper, error) {
+	switch mode {
+	case HTTPModeLive:
+		return base, nil
+	case HTTPModeRecord:
+		return &RecordingTransport{Dir: dir, Base: base}, nil
+	case HTTPModeReplay:
+		return &ReplayTransport{Dir: dir}, nil
+	}
+	return nil, fmt.Errorf("unknown HTTP mode %q", mode)
+}
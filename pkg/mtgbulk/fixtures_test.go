@@ -0,0 +1,63 @@
+package mtgbulk
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// fixturesRegistry searches only MtgTrade at baseURL in the given HTTP mode
+func fixturesRegistry(t *testing.T, mode HTTPMode, dir, baseURL string) *Registry {
+	cfg := Config{
+		Platforms:   make(map[string]PlatformConfig),
+		HTTPMode:    mode,
+		FixturesDir: dir,
+		HTTP:        &HTTPPolicy{},
+	}
+	for _, b := range builtinSearchers {
+		cfg.Platforms[b.platform.String()] = PlatformConfig{BaseURL: baseURL, Disabled: b.platform != MtgTrade}
+	}
+	r, err := NewConfiguredRegistry(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtgbulk-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var requests []string
+	srv := newPagesServer(t, "mtgtrade", &requests)
+	baseURL := srv.URL
+	q := SearchQuery{Name: "Lightning Bolt"}
+
+	recorder := fixturesRegistry(t, HTTPModeRecord, dir, baseURL).Searchers()[0]
+	recorded, err := recorder.Search(context.Background(), q)
+	if err != nil {
+		t.Fatalf("recording failed: %s", err)
+	}
+	srv.Close()
+	if len(requests) < 2 || len(recorded.Prices) == 0 {
+		t.Fatalf("several pages with offers are expected to be recorded, got %v and %+v", requests, recorded)
+	}
+
+	replayer := fixturesRegistry(t, HTTPModeReplay, dir, baseURL).Searchers()[0]
+	replayed, err := replayer.Search(context.Background(), q)
+	if err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed result differs from the recorded one\nrecorded: %+v\nreplayed: %+v", recorded, replayed)
+	}
+
+	if _, err := replayer.Search(context.Background(), SearchQuery{Name: "Counterspell"}); err == nil {
+		t.Error("a search which has not been recorded is expected to fail")
+	}
+}
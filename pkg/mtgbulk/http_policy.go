@@ -0,0 +1,255 @@
+package mtgbulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// HTTPPolicy is applied to every request made by built-in searchers.
+type HTTPPolicy struct {
+	// Timeout limits a single attempt including reading the body. No limit if 0
+	Timeout time.Duration
+	// UserAgent replaces the default one if not empty
+	UserAgent string
+	// ProxyURL is used for all requests if not empty. Otherwise proxy is taken from environment
+	ProxyURL string
+	// Retries is the number of additional attempts made on 5xx responses and timeouts
+	Retries int
+	// RetryBackoff is the pause before the first retry, it is doubled for every next one
+	RetryBackoff time.Duration
+	// Delay is the minimal interval between requests to the same domain
+	Delay time.Duration
+	// DomainDelays overrides Delay for particular domains, e.g. "mtgtrade.net"
+	DomainDelays map[string]time.Duration
+}
+
+var DefaultHTTPPolicy = HTTPPolicy{
+	Timeout:      20 * time.Second,
+	UserAgent:    "mtgbulkbuy (+https://github.com/ilyalavrinov/mtgbulkbuy)",
+	Retries:      2,
+	RetryBackoff: time.Second,
+	Delay:        200 * time.Millisecond,
+}
+
+// httpPolicyJSON mirrors HTTPPolicy with durations written like "20s".
+type httpPolicyJSON struct {
+	Timeout      string            `json:"timeout"`
+	UserAgent    string            `json:"user_agent"`
+	ProxyURL     string            `json:"proxy_url"`
+	Retries      *int              `json:"retries"`
+	RetryBackoff string            `json:"retry_backoff"`
+	Delay        string            `json:"delay"`
+	DomainDelays map[string]string `json:"domain_delays"`
+}
+
+// UnmarshalJSON reads the policy on top of DefaultHTTPPolicy, so only overridden fields are needed.
+func (p *HTTPPolicy) UnmarshalJSON(data []byte) error {
+	var raw httpPolicyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	res := DefaultHTTPPolicy
+	res.DomainDelays = make(map[string]time.Duration, len(raw.DomainDelays))
+	var err error
+	parse := func(field, s string, d *time.Duration) {
+		if s == "" || err != nil {
+			return
+		}
+		*d, err = time.ParseDuration(s)
+		if err != nil {
+			err = fmt.Errorf("bad %s: %w", field, err)
+		}
+	}
+	parse("timeout", raw.Timeout, &res.Timeout)
+	parse("retry_backoff", raw.RetryBackoff, &res.RetryBackoff)
+	parse("delay", raw.Delay, &res.Delay)
+	for domain, s := range raw.DomainDelays {
+		var d time.Duration
+		parse("delay for "+domain, s, &d)
+		res.DomainDelays[domain] = d
+	}
+	if err != nil {
+		return err
+	}
+	if raw.UserAgent != "" {
+		res.UserAgent = raw.UserAgent
+	}
+	if raw.ProxyURL != "" {
+		res.ProxyURL = raw.ProxyURL
+	}
+	if raw.Retries != nil {
+		res.Retries = *raw.Retries
+	}
+
+	*p = res
+	return p.validate()
+}
+
+func (p *HTTPPolicy) validate() error {
+	if p.ProxyURL != "" {
+		if _, err := url.Parse(p.ProxyURL); err != nil {
+			return fmt.Errorf("bad proxy URL: %w", err)
+		}
+	}
+	if p.Retries < 0 {
+		return fmt.Errorf("retries cannot be negative: %d", p.Retries)
+	}
+	return nil
+}
+
+func (p *HTTPPolicy) domainDelay(domain string) time.Duration {
+	if d, found := p.DomainDelays[domain]; found {
+		return d
+	}
+	return p.Delay
+}
+
+// baseTransport returns a fresh transport which uses the proxy of the policy.
+func (p *HTTPPolicy) baseTransport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if p.ProxyURL != "" {
+		proxy, err := url.Parse(p.ProxyURL)
+		if err != nil {
+			logger.Errorw("bad proxy URL, going without it",
+				"proxy", p.ProxyURL,
+				"err", err)
+		} else {
+			tr.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	return tr
+}
+
+// domainLimiter makes sure requests to the same domain are started not more often than requested.
+type domainLimiter struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+// rateLimiter is shared by all searchers, so the limits hold no matter how many requests are processed at once.
+var rateLimiter = &domainLimiter{
+	next: make(map[string]time.Time),
+}
+
+func (l *domainLimiter) wait(ctx context.Context, domain string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next[domain]
+	if start.Before(now) {
+		start = now
+	}
+	l.next[domain] = start.Add(delay)
+	l.mu.Unlock()
+
+	return sleepContext(ctx, start.Sub(now))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type policyTransport struct {
+	policy HTTPPolicy
+	base   http.RoundTripper
+}
+
+// cancelBody releases the attempt context once the body is consumed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	canRetry := req.Body == nil || req.GetBody != nil
+	backoff := t.policy.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		if err := rateLimiter.wait(ctx, req.URL.Host, t.policy.domainDelay(req.URL.Host)); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.attempt(req)
+		retriable := false
+		if err != nil {
+			var netErr net.Error
+			retriable = ctx.Err() == nil && (errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()))
+		} else if resp.StatusCode >= 500 {
+			retriable = true
+		}
+		if !retriable || !canRetry || attempt >= t.policy.Retries {
+			return resp, err
+		}
+
+		logger.Debugw("retrying request",
+			"url", req.URL.String(),
+			"attempt", attempt+1,
+			"backoff", backoff,
+			"err", err)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+func (t *policyTransport) attempt(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if t.policy.UserAgent != "" {
+		req.Header.Set("User-Agent", t.policy.UserAgent)
+	}
+	if t.policy.Timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.policy.Timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
@@ -0,0 +1,67 @@
+package mtgbulk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicyRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.Header.Get("User-Agent") != "test-agent" {
+			t.Errorf("unexpected User-Agent %q", r.Header.Get("User-Agent"))
+		}
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html></html>"))
+	}))
+	defer srv.Close()
+
+	policy := HTTPPolicy{
+		UserAgent:    "test-agent",
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	}
+	s := NewMtgSaleSearcher(SearcherOptions{BaseURL: srv.URL, HTTP: &policy})
+	res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	if err != nil {
+		t.Fatalf("search failed: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("3 attempts are expected, got %d", attempts)
+	}
+	if res.Diagnostics[0].HTTPCode != http.StatusOK {
+		t.Errorf("unexpected diagnostics %+v", res.Diagnostics[0])
+	}
+}
+
+func TestPolicyGivesUpAfterRetries(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	policy := HTTPPolicy{
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	}
+	s := NewMtgSaleSearcher(SearcherOptions{BaseURL: srv.URL, HTTP: &policy})
+	res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	if err == nil {
+		t.Fatal("error is expected")
+	}
+	if attempts != 2 {
+		t.Errorf("2 attempts are expected, got %d", attempts)
+	}
+	if res.Diagnostics[0].HTTPCode != http.StatusBadGateway {
+		t.Errorf("unexpected diagnostics %+v", res.Diagnostics[0])
+	}
+}
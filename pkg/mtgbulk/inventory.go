@@ -0,0 +1,197 @@
+package mtgbulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseInventory reads an owned collection: card name or Oracle ID -> owned copies.
+// It is either a text list like ParseText reads or CSV with a header which has
+// a "name" (or "card", "oracle_id") column and a "count" (or "quantity", "qty") column.
+// Repeated cards are summed up.
+func ParseInventory(r io.Reader) (map[string]int, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	header := string(first)
+	if i := strings.IndexByte(header, '\n'); i >= 0 {
+		header = header[:i]
+	}
+	if nameCol, countCol := inventoryColumns(header); nameCol >= 0 {
+		return parseInventoryCSV(br, nameCol, countCol)
+	}
+
+	inventory := make(map[string]int)
+	scanner := bufio.NewScanner(br)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		name, quantity, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse inventory line %q: %w", line, err)
+		}
+		inventory[name] += quantity
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// inventoryColumns finds columns of a CSV header, the name column is -1 if the line is not such a header.
+// The count column is -1 if every row is a single copy.
+func inventoryColumns(header string) (int, int) {
+	nameCol, countCol := -1, -1
+	if !strings.Contains(header, ",") {
+		return nameCol, countCol
+	}
+	for i, col := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.Trim(strings.TrimSpace(col), `"`)) {
+		case "oracle_id":
+			nameCol = i
+		case "name", "card", "cardname":
+			if nameCol < 0 {
+				nameCol = i
+			}
+		case "count", "quantity", "qty":
+			countCol = i
+		}
+	}
+	return nameCol, countCol
+}
+
+func parseInventoryCSV(r io.Reader, nameCol, countCol int) (map[string]int, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	if _, err := cr.Read(); err != nil {
+		return nil, err
+	}
+	inventory := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if nameCol >= len(record) || strings.TrimSpace(record[nameCol]) == "" {
+			continue
+		}
+		quantity := 1
+		if countCol >= 0 && countCol < len(record) {
+			quantity, err = strconv.Atoi(strings.TrimSpace(record[countCol]))
+			if err != nil {
+				return nil, fmt.Errorf("could not parse count of %q: %w", record[nameCol], err)
+			}
+		}
+		inventory[strings.TrimSpace(record[nameCol])] += quantity
+	}
+	return inventory, nil
+}
+
+// cardKey is what names of the same card have in common: the Oracle ID if the library knows it,
+// the English name or the name itself otherwise.
+func cardKey(lib Library, name string) string {
+	if resolver, ok := lib.(OracleIDResolver); ok {
+		if id, err := resolver.OracleID(name); err == nil {
+			return id
+		}
+	}
+	if english, err := lib.EnglishName(name); err == nil && english != "" {
+		return strings.ToLower(english)
+	}
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// subtractInventory takes owned copies out of requested ones. It returns copies still to be bought
+// and copies taken from the inventory per card. Lines sharing a card take owned copies in order of names.
+func subtractInventory(lib Library, cards map[string]int, inventory map[string]int) (map[string]int, map[string]int) {
+	owned := make(map[string]int, len(inventory))
+	for name, n := range inventory {
+		if n > 0 {
+			owned[cardKey(lib, name)] += n
+		}
+	}
+
+	names := make([]string, 0, len(cards))
+	for name := range cards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	left := make(map[string]int, len(cards))
+	taken := make(map[string]int)
+	for _, name := range names {
+		if cardName(name) != name {
+			// owned copies are of unknown printings, they do not cover lines asking for one
+			left[name] = cards[name]
+			continue
+		}
+		key := cardKey(lib, name)
+		n := cards[name]
+		if owned[key] < n {
+			n = owned[key]
+		}
+		owned[key] -= n
+		if n > 0 {
+			taken[name] = n
+		}
+		if cards[name] > n {
+			left[name] = cards[name] - n
+		}
+	}
+	return left, taken
+}
+
+// takeFromOwners leaves owners with copies still to be bought once taken copies come from the inventory.
+// Copies nobody has claimed are taken first, then copies of owners in order of their names.
+// cards are requested copies before the inventory is subtracted. owners are not modified.
+func takeFromOwners(cards map[string]int, owners map[string]map[string]int, taken map[string]int) map[string]map[string]int {
+	if len(owners) == 0 || len(taken) == 0 {
+		return owners
+	}
+	result := make(map[string]map[string]int, len(owners))
+	for card, wanted := range owners {
+		n := taken[card]
+		claimed := 0
+		names := make([]string, 0, len(wanted))
+		for owner, copies := range wanted {
+			claimed += copies
+			names = append(names, owner)
+		}
+		sort.Strings(names)
+		if unclaimed := cards[card] - claimed; unclaimed > 0 {
+			n -= unclaimed
+		}
+
+		left := make(map[string]int, len(wanted))
+		for _, owner := range names {
+			copies := wanted[owner]
+			if n > 0 {
+				covered := copies
+				if covered > n {
+					covered = n
+				}
+				copies -= covered
+				n -= covered
+			}
+			if copies > 0 {
+				left[owner] = copies
+			}
+		}
+		if len(left) > 0 {
+			result[card] = left
+		}
+	}
+	return result
+}
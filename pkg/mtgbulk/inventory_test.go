@@ -0,0 +1,162 @@
+package mtgbulk
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInventory(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]int
+	}{
+		{"text", "4 Lightning Bolt\n\n2 Молния\n1 Lightning Bolt\n", map[string]int{"Lightning Bolt": 5, "Молния": 2}},
+		{"csv", "name,count\nLightning Bolt,3\n\"Fire // Ice\",1\nLightning Bolt,1\n", map[string]int{"Lightning Bolt": 4, "Fire // Ice": 1}},
+		{"csv without count", "Card,Set\nShock,m19\nShock,m20\n", map[string]int{"Shock": 2}},
+		{"csv oracle id", "name,oracle_id,qty\nLightning Bolt,oracle-bolt,2\n", map[string]int{"oracle-bolt": 2}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseInventory(strings.NewReader(tc.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseInventory(strings.NewReader("name,count\nShock,many\n")); err == nil {
+		t.Error("a count which is not a number is expected to fail")
+	}
+}
+
+func TestSubtractInventory(t *testing.T) {
+	lib := useTestLibrary(t)
+	tests := []struct {
+		name      string
+		cards     map[string]int
+		inventory map[string]int
+		left      map[string]int
+		taken     map[string]int
+	}{
+		{
+			name:      "same name",
+			cards:     map[string]int{"Lightning Bolt": 4, "Shock": 2},
+			inventory: map[string]int{"Lightning Bolt": 3},
+			left:      map[string]int{"Lightning Bolt": 1, "Shock": 2},
+			taken:     map[string]int{"Lightning Bolt": 3},
+		},
+		{
+			name:      "oracle id",
+			cards:     map[string]int{"Lightning Bolt": 2},
+			inventory: map[string]int{"oracle-bolt": 5},
+			left:      map[string]int{},
+			taken:     map[string]int{"Lightning Bolt": 2},
+		},
+		{
+			name:      "russian alias",
+			cards:     map[string]int{"Lightning Bolt": 3, "Молния": 2},
+			inventory: map[string]int{"молния": 4},
+			left:      map[string]int{"Молния": 1},
+			taken:     map[string]int{"Lightning Bolt": 3, "Молния": 1},
+		},
+		{
+			name:      "printing",
+			cards:     map[string]int{printingKey("Lightning Bolt", Printing{Set: "m10"}): 2},
+			inventory: map[string]int{"Lightning Bolt": 2},
+			left:      map[string]int{printingKey("Lightning Bolt", Printing{Set: "m10"}): 2},
+			taken:     map[string]int{},
+		},
+		{
+			name:      "other card",
+			cards:     map[string]int{"Counterspell": 1},
+			inventory: map[string]int{"Lightning Bolt": 1, "Shock": 0},
+			left:      map[string]int{"Counterspell": 1},
+			taken:     map[string]int{},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			left, taken := subtractInventory(lib, tc.cards, tc.inventory)
+			if !reflect.DeepEqual(left, tc.left) {
+				t.Errorf("expected left %v, got %v", tc.left, left)
+			}
+			if !reflect.DeepEqual(taken, tc.taken) {
+				t.Errorf("expected taken %v, got %v", tc.taken, taken)
+			}
+		})
+	}
+}
+
+func TestTakeFromOwners(t *testing.T) {
+	tests := []struct {
+		name   string
+		cards  map[string]int
+		owners map[string]map[string]int
+		taken  map[string]int
+		want   map[string]map[string]int
+	}{
+		{
+			name:   "unclaimed first",
+			cards:  map[string]int{"Lightning Bolt": 5},
+			owners: map[string]map[string]int{"Lightning Bolt": {"alice": 2, "bob": 2}},
+			taken:  map[string]int{"Lightning Bolt": 2},
+			want:   map[string]map[string]int{"Lightning Bolt": {"alice": 1, "bob": 2}},
+		},
+		{
+			name:   "owners by name",
+			cards:  map[string]int{"Lightning Bolt": 4, "Shock": 1},
+			owners: map[string]map[string]int{"Lightning Bolt": {"bob": 2, "alice": 2}, "Shock": {"bob": 1}},
+			taken:  map[string]int{"Lightning Bolt": 3},
+			want:   map[string]map[string]int{"Lightning Bolt": {"bob": 1}, "Shock": {"bob": 1}},
+		},
+		{
+			name:   "covered",
+			cards:  map[string]int{"Lightning Bolt": 2},
+			owners: map[string]map[string]int{"Lightning Bolt": {"alice": 2}},
+			taken:  map[string]int{"Lightning Bolt": 2},
+			want:   map[string]map[string]int{},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if got := takeFromOwners(tc.cards, tc.owners, tc.taken); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessBillsLeaveOutInventory(t *testing.T) {
+	useTestLibrary(t)
+	registry := NewRegistry()
+	registry.Register(offersSearcher("shop", map[string][]CardPrice{
+		"Lightning Bolt": {{Price: 10, Quantity: 1}, {Price: 20, Quantity: 4}},
+	}))
+	req, err := ParseText(strings.NewReader("2 Lightning Bolt @alice\n2 Lightning Bolt @bob\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	req.Searchers = registry
+	req.Inventory = map[string]int{"Молния": 1}
+
+	result, err := ProcessByNamesContext(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]float32{"alice": {10}, "bob": {20, 20}}
+	if got := billPrices(result.Bills); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected bills %v, got %v", want, got)
+	}
+	if got := req.Owners["Lightning Bolt"]; !reflect.DeepEqual(got, map[string]int{"alice": 2, "bob": 2}) {
+		t.Errorf("owners of the request are not expected to change, got %v", got)
+	}
+}
@@ -2,28 +2,96 @@ package mtgbulk
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // TODO: remove this ugly hack
 var cardLib Library
 var libOnce sync.Once
 
+// SetLibrary makes requests use lib instead of the Scryfall dump loaded by the first request.
+// It has to be called before any request is processed.
+func SetLibrary(lib Library) {
+	libOnce.Do(func() {})
+	cardLib = lib
+}
+
 type NamesRequest struct {
 	Cards map[string]int
-
+	// Lines are the lines of the list Cards have been read from, if it has been parsed
+	Lines []ListLine
+
+	// Searchers is a set of platforms to search at. DefaultRegistry is used if nil
+	Searchers *Registry
+	// Concurrency limits the number of searches running at once. DefaultConcurrency is used if 0
+	Concurrency int
+	// DomainConcurrency limits the number of searches running at once against one domain. DefaultDomainConcurrency is used if 0
+	DomainConcurrency int
+	// Timeout limits the total processing time of the request if positive
+	Timeout time.Duration
+
+	// DeliveryFee is charged by every seller. It overrides Delivery.Default if positive
 	DeliveryFee int
+	// Delivery enables delivery-aware plan with fees depending on sellers and platforms
+	Delivery *DeliveryRules
+	// Strategy chooses how the delivery-aware plan is searched for
+	Strategy PlanStrategy
+	// PlanBudget limits the time spent on the delivery-aware plan. DefaultPlanBudget is used if 0
+	PlanBudget time.Duration
+	// MaxSellers limits the number of sellers in the delivery-aware plan, i.e. the number of packages. No limit if 0
+	MaxSellers int
+	// Alternatives is the number of plans with different sets of sellers to look for. Only the cheapest one if 0
+	Alternatives int
+	// Sellers filters and weights offers for min prices and the delivery-aware plan.
+	// The matrix keeps actual prices of permitted sellers and orders them by weighted totals
+	Sellers *SellerPolicy
+	// Budget limits money spent on min prices and plans, delivery included. Everything is bought if 0
+	Budget float32
+	// Priorities tell which cards to buy first if the budget is not enough: card name -> priority
+	Priorities map[string]Priority
+	// Owners tell who wants the cards of a group buy: card name -> owner -> copies. Bills are made if not empty
+	Owners map[string]map[string]int
+	// Split chooses how delivery fees are shared in bills
+	Split SplitMode
+	// Printings narrow lines down to specific printings: request key -> printing. A line asking for a printing
+	// is keyed by the card name followed by the printing in braces, e.g. "Volcanic Island {set=3ED}",
+	// the same keys are used in Cards, Owners and Priorities. Lines of the same card share one search
+	Printings map[string]Printing
+	// Issues are problems found while the list has been parsed
+	Issues []Issue
+	// Inventory is an owned collection: card name or Oracle ID -> copies. Owned copies are not searched for.
+	// They cover unclaimed copies first, then copies of Owners in order of their names
+	Inventory map[string]int
+
 	onlySingles *bool
 }
 
+// deliveryRules returns rules the plan should be made with, nil if the plan is not needed.
+func (req *NamesRequest) deliveryRules() *DeliveryRules {
+	if req.DeliveryFee <= 0 {
+		if req.Delivery == nil && (req.MaxSellers > 0 || req.Alternatives > 0) {
+			// plans are needed even if they are delivered for free
+			return &DeliveryRules{}
+		}
+		return req.Delivery
+	}
+	var rules DeliveryRules
+	if req.Delivery != nil {
+		rules = *req.Delivery
+	}
+	rules.Default = DeliveryPolicy{Fee: float32(req.DeliveryFee)}
+	return &rules
+}
+
 func (req *NamesRequest) hasOnlySingles() bool {
 	if req.onlySingles != nil {
 		return *req.onlySingles
@@ -56,12 +124,35 @@ const (
 	TopDeck      PlatformType = iota
 )
 
+var platformsMu sync.RWMutex
+var lastPlatform = TopDeck
+var customPlatforms = make(map[PlatformType]string)
+
 var shops = map[PlatformType]bool{
 	MtgSale:      true,
 	SpellMarket:  true,
 	AutumnsMagic: true,
 }
 
+// RegisterPlatform allocates a new PlatformType for a custom Searcher.
+// shop should be true if the platform is a single shop rather than a marketplace of many traders.
+func RegisterPlatform(name string, shop bool) PlatformType {
+	platformsMu.Lock()
+	defer platformsMu.Unlock()
+	lastPlatform++
+	customPlatforms[lastPlatform] = name
+	if shop {
+		shops[lastPlatform] = true
+	}
+	return lastPlatform
+}
+
+func isShop(pt PlatformType) bool {
+	platformsMu.RLock()
+	defer platformsMu.RUnlock()
+	return shops[pt]
+}
+
 func (pt PlatformType) String() string {
 	switch pt {
 	case MtgSale:
@@ -71,11 +162,13 @@ func (pt PlatformType) String() string {
 	case SpellMarket:
 		return "SpellMarket"
 	case AutumnsMagic:
-		return "AutumsMagic"
+		return "AutumnsMagic"
 	case TopDeck:
 		return "TopDeck"
 	}
-	return ""
+	platformsMu.RLock()
+	defer platformsMu.RUnlock()
+	return customPlatforms[pt]
 }
 
 type CurrencyType int
@@ -100,11 +193,31 @@ func (c CurrencyType) MarshalJSON() ([]byte, error) {
 	return json.Marshal(c.String())
 }
 
+func (c *CurrencyType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	for _, known := range []CurrencyType{RUR, USD} {
+		if known.String() == s {
+			*c = known
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown currency %q", s)
+}
+
 type CardPrice struct {
-	Price    float32
-	Foil     bool
-	Currency CurrencyType
-	Quantity int
+	Price float32
+	Foil  bool
+	// FoilUnknown is true if the seller does not tell foil copies apart, Foil is false then
+	FoilUnknown bool `json:",omitempty"`
+	Currency    CurrencyType
+	Quantity    int
+	// Edition is a set name or code as the seller writes it, empty if unknown
+	Edition string `json:",omitempty"`
+	// Language is a language code of the printing, empty if unknown
+	Language string `json:",omitempty"`
 
 	Platform PlatformType
 	Trader   string
@@ -112,7 +225,7 @@ type CardPrice struct {
 }
 
 func (cp *CardPrice) SellerFullName() string {
-	if shops[cp.Platform] {
+	if isShop(cp.Platform) {
 		return cp.Trader
 	}
 	return cp.Trader + "@" + cp.Platform.String()
@@ -121,6 +234,9 @@ func (cp *CardPrice) SellerFullName() string {
 type CardResult struct {
 	Available bool
 	Prices    []CardPrice
+
+	// Diagnostics contains one entry per platform searched
+	Diagnostics []SearchDiagnostics
 }
 
 func newCardResult() CardResult {
@@ -135,28 +251,89 @@ func (c *CardResult) merge(other CardResult) {
 		c.Available = true
 	}
 	c.Prices = append(c.Prices, other.Prices...)
+	c.Diagnostics = append(c.Diagnostics, other.Diagnostics...)
 }
 
 func (c *CardResult) sortByPrice() {
-	sort.Slice(c.Prices, func(i, j int) bool {
+	sort.SliceStable(c.Prices, func(i, j int) bool {
 		return c.Prices[i].Price < c.Prices[j].Price
 	})
 }
 
+// NamesResult is keyed by request keys (see NamesRequest.Printings) except for AllSortedCards and Diagnostics
+// which are keyed by card names searched for.
 type NamesResult struct {
 	AllSortedCards map[string]CardResult
 
 	MinPricesNoDelivery          map[string][]CardPrice
 	WithDeliveryByEliminateFewer map[string]CardPrice
 	MinPricesMatrix              *PossessionMatrix
+
+	// DeliveryPlan is the cheapest plan including delivery fees. It is calculated only if delivery is requested
+	DeliveryPlan *PurchasePlan
+	// Plans are the cheapest plans with different sets of sellers, the first one is DeliveryPlan
+	Plans []*PurchasePlan
+
+	// Diagnostics describes how searches went: card name -> one entry per platform
+	Diagnostics map[string][]SearchDiagnostics
+
+	// Unknown cards are not in the card library, so they have not been searched for
+	Unknown []UnknownCard
+	// Unavailable cards cannot be bought in the requested quantity. Min prices and plans cover what is available
+	Unavailable []UnavailableCard
+	// Deferred lists copies left out of MinPricesNoDelivery to fit the budget: card name -> copies
+	Deferred map[string]int
+	// Issues are problems found while the list has been parsed, see NamesRequest.Issues
+	Issues []Issue
+	// FromInventory lists copies taken from the owned collection: card name -> copies
+	FromInventory map[string]int
+	// Covered cards are owned in the requested quantity, so they have not been searched for
+	Covered []string
+	// Bills tell what every owner pays, they follow DeliveryPlan if there is one and MinPricesNoDelivery otherwise
+	Bills []Bill
 }
 
+type UnknownCard struct {
+	Name string
+	// Suggestions are known names similar to Name
+	Suggestions []string
+}
+
+type UnavailableCard struct {
+	Name      string
+	Requested int
+	// Missing is the number of requested copies nobody sells
+	Missing int
+}
+
+// maxSuggestions limits the number of names suggested for an unknown card.
+const maxSuggestions = 5
+
 func ProcessByNames(req NamesRequest) (*NamesResult, error) {
+	return ProcessByNamesContext(context.Background(), req)
+}
+
+// ProcessByNamesContext is like ProcessByNames but stops scraping once ctx is done.
+// In that case the result is made of whatever has been found so far, the budget and owners are applied as usual,
+// and it is returned along with an error wrapping ctx.Err(). Errors of the budget and the seller limit are returned
+// instead if the partial result cannot meet them.
+func ProcessByNamesContext(ctx context.Context, req NamesRequest) (*NamesResult, error) {
 	logger.Debugw("Incoming ProcessByNames request",
 		"count", len(req.Cards))
 
+	if err := req.validateOptions(); err != nil {
+		return nil, &OptionsError{Err: err}
+	}
+
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+
 	result := &NamesResult{
 		AllSortedCards: make(map[string]CardResult, len(req.Cards)),
+		Issues:         req.Issues,
 	}
 
 	// TODO: remove this ugly hack
@@ -169,56 +346,140 @@ func ProcessByNames(req NamesRequest) (*NamesResult, error) {
 		}
 	})
 
-	for name := range req.Cards {
+	if len(req.Inventory) > 0 {
+		requested := req.Cards
+		req.Cards, result.FromInventory = subtractInventory(cardLib, req.Cards, req.Inventory)
+		req.Owners = takeFromOwners(requested, req.Owners, result.FromInventory)
+		for name := range result.FromInventory {
+			if _, found := req.Cards[name]; !found {
+				result.Covered = append(result.Covered, name)
+			}
+		}
+		sort.Strings(result.Covered)
+	}
+
+	registry := req.Searchers
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+
+	// lines asking for different printings of a card share its search
+	names := make([]string, 0, len(req.Cards))
+	seen := make(map[string]bool, len(req.Cards))
+	for key := range req.Cards {
+		if name := cardName(key); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// unknown cards are reported and the rest is processed as if they have not been requested
+	unknown := make(map[string]bool)
+	queries := make([]SearchQuery, 0, len(names))
+	for _, name := range names {
 		allNames, err := cardLib.CardAliases(name)
 		if err != nil {
-			logger.Errorw("could not get all names for card, is it missing?",
+			logger.Warnw("could not get all names for card, is it missing?",
 				"err", err)
-			return result, err
+			result.Unknown = append(result.Unknown, unknownCard(cardLib, name))
+			unknown[name] = true
+			continue
 		}
 
 		englishName, err := cardLib.EnglishName(name)
 		if err != nil {
-			logger.Errorw("could not get english name for card, is it missing?",
+			logger.Warnw("could not get english name for card, is it missing?",
 				"err", err)
-			return result, err
+			result.Unknown = append(result.Unknown, unknownCard(cardLib, name))
+			unknown[name] = true
+			continue
 		}
 
-		cardRes := newCardResult()
-		cardRes.merge(searchMtgSale(name))
-		cardRes.merge(searchMtgTrade(name))
-		cardRes.merge(searchSpellMarket(name, allNames))
-		cardRes.merge(searchAutumnsMagic(englishName, allNames))
-		cardRes.merge(searchTopDeck(name))
-		cardRes.sortByPrice()
-		result.AllSortedCards[name] = cardRes
+		queries = append(queries, SearchQuery{
+			Name:        name,
+			EnglishName: englishName,
+			Aliases:     allNames,
+		})
 	}
 
-	greedyMinPrices, err := calcGreedyMinPrices(req, result.AllSortedCards)
-	if err != nil {
-		logger.Errorw("could not calculate greedy min prices",
-			"err", err)
-		return result, err
+	known := make(map[string]int, len(req.Cards))
+	for key, n := range req.Cards {
+		if !unknown[cardName(key)] {
+			known[key] = n
+		}
 	}
-	result.MinPricesNoDelivery = greedyMinPrices
+	req.Cards = known
 
-	result.MinPricesMatrix = fillMinPricesMatrix(result.AllSortedCards)
+	pool := newSearchPool(registry.Searchers(), req.Concurrency, req.DomainConcurrency)
+	result.AllSortedCards = pool.run(ctx, queries)
+	result.Diagnostics = make(map[string][]SearchDiagnostics, len(result.AllSortedCards))
+	for name, res := range result.AllSortedCards {
+		result.Diagnostics[name] = res.Diagnostics
+	}
+	// an interrupted search is processed as usual, plans are made of whatever has been found so far
+	interrupted := ctx.Err()
+	if interrupted != nil {
+		logger.Warnw("search interrupted",
+			"err", interrupted)
+	}
+
+	// AllSortedCards keeps everything found, the rest is calculated per request line with offers
+	// permitted by the seller policy of requested printings
+	cards := applyPrintings(cardLib, req, req.Sellers.apply(result.AllSortedCards))
+	result.Unavailable = findUnavailable(req, cards)
+	result.MinPricesNoDelivery = calcGreedyMinPrices(req, cards)
+	result.MinPricesMatrix = fillMinPricesMatrix(cards, req.Sellers)
+	if req.Budget > 0 {
+		minPrices, deferred, err := fitGreedyBudget(req, result.MinPricesNoDelivery)
+		if err != nil {
+			logger.Errorw("could not fit min prices into budget",
+				"err", err)
+			return result, err
+		}
+		result.MinPricesNoDelivery = minPrices
+		result.Deferred = deferred
+	}
 
-	if req.DeliveryFee > 0 && req.hasOnlySingles() {
-		eliminateFewer, err := evaluateConsideringDelivery(req, result.AllSortedCards, greedyMinPrices)
+	if rules := req.deliveryRules(); rules != nil {
+		plans, err := evaluateConsideringDelivery(ctx, req, rules, cards)
 		if err != nil {
 			logger.Errorw("could not calculate min prices with delivery",
 				"err", err)
 			return result, err
 		}
-		result.WithDeliveryByEliminateFewer = eliminateFewer
+		result.Plans = plans
+		result.DeliveryPlan = plans[0]
+		if req.hasOnlySingles() {
+			result.WithDeliveryByEliminateFewer = result.DeliveryPlan.singles()
+		}
 	}
 
+	if len(req.Owners) > 0 {
+		if result.DeliveryPlan != nil {
+			result.Bills = splitBills(req.Owners, result.DeliveryPlan.Sellers, req.Split)
+		} else {
+			result.Bills = splitBills(req.Owners, ordersFromMinPrices(result.MinPricesNoDelivery), req.Split)
+		}
+	}
+
+	if interrupted != nil {
+		return result, fmt.Errorf("search interrupted: %w", interrupted)
+	}
 	return result, nil
 }
 
 var quantityRe *regexp.Regexp = regexp.MustCompile("^(\\d+)x?\\s*(.*)$")
 
+// priorityRe matches a priority written after a card name, e.g. "4 Lightning Bolt [must]"
+var priorityRe *regexp.Regexp = regexp.MustCompile(`^(.*?)\s*\[([^\]]*)\]$`)
+
+// printingRe matches printing constraints written after a card name, e.g. "Volcanic Island {set=3ED lang=en}"
+var printingRe *regexp.Regexp = regexp.MustCompile(`^(.*?)\s*\{([^}]*)\}$`)
+
+// ownerRe matches an owner of a group buy line written at the end, e.g. "4 Lightning Bolt [must] @alice"
+var ownerRe *regexp.Regexp = regexp.MustCompile(`^(.*?)\s+@(\S+)$`)
+
 func parseLine(line string) (string, int, error) {
 	quantity := 1
 	cardname := line
@@ -239,10 +500,63 @@ func parseLine(line string) (string, int, error) {
 	return cardname, quantity, nil
 }
 
-func ProcessText(r io.Reader) (*NamesResult, error) {
+// ParseText reads a card list ("N[x] name {printing} [priority] @owner" per line, all but the name are optional)
+// into a request. It is ParseTextMode in strict mode.
+func ParseText(r io.Reader) (NamesRequest, error) {
+	return ParseTextMode(r, ValidationStrict)
+}
+
+// textLine is a parsed line of a text list
+type textLine struct {
+	name     string
+	quantity int
+	owner    string
+	prio     *Priority
+	printing Printing
+}
+
+func parseTextLine(line string) (textLine, error) {
+	var l textLine
+	if m := ownerRe.FindStringSubmatch(line); m != nil {
+		l.owner = m[2]
+		line = m[1]
+	}
+	if m := priorityRe.FindStringSubmatch(line); m != nil {
+		p, err := ParsePriority(m[2])
+		if err != nil {
+			return l, err
+		}
+		l.prio = &p
+		line = m[1]
+	}
+	if m := printingRe.FindStringSubmatch(line); m != nil {
+		p, err := ParsePrinting(m[2])
+		if err != nil {
+			return l, err
+		}
+		l.printing = p
+		line = m[1]
+	}
+	var err error
+	l.name, l.quantity, err = parseLine(line)
+	if err != nil {
+		return l, err
+	}
+	if l.quantity <= 0 {
+		return l, fmt.Errorf("illegal quantity for card %q has been requested: %d", l.name, l.quantity)
+	}
+	return l, nil
+}
+
+// ParseTextMode reads a text list checking every line, problems are reported as Issues of the request.
+// Repeated cards are merged: lines of different owners silently, other duplicates with a warning.
+// Lines with errors fail the list in strict mode and are skipped in lenient one, see ValidationError.
+func ParseTextMode(r io.Reader, mode ValidationMode) (NamesRequest, error) {
 	cards := NewNamesRequest()
 	scanner := bufio.NewScanner(r)
+	lineNo := 0
 	for scanner.Scan() {
+		lineNo++
 		line := scanner.Text()
 		logger.Debugw("New line read from body",
 			"line", line)
@@ -250,73 +564,188 @@ func ProcessText(r io.Reader) (*NamesResult, error) {
 		if len(line) == 0 {
 			continue
 		}
-		name, quantity, err := parseLine(line)
+		l, err := parseTextLine(line)
 		if err != nil {
-			logger.Warnw("could not parse line",
-				"err", err,
-				"line", line)
-			return nil, err
+			cards.issue(lineNo, SeverityError, "%s", err)
+			continue
 		}
-
 		logger.Debugw("Parsed line",
 			"line", line,
-			"cardname", name,
-			"quantity", quantity)
+			"cardname", l.name,
+			"quantity", l.quantity)
+		cards.addTextLine(lineNo, l)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warnw("Error reading body",
+			"err", err)
+		return cards, err
+	}
 
-		if _, found := cards.Cards[name]; found {
-			logger.Warnw("Duplicated card",
-				"name", name)
-			return nil, fmt.Errorf("Card with name %q is duplicated in the list", name)
-		}
+	return cards.validate(mode)
+}
 
-		if quantity <= 0 {
-			logger.Warnw("Illegal requested quantity",
-				"name", name,
-				"quantity", quantity)
-			return nil, fmt.Errorf("Illegal quantity for card %q has been requested: %d", name, quantity)
+// addTextLine merges a parsed line into the request: lines of different owners silently,
+// other duplicates with a warning. Lines asking for different printings of a card are kept apart, see printingKey.
+func (req *NamesRequest) addTextLine(lineNo int, l textLine) {
+	// the number is not matched, so lines differing only in numbers are the same line
+	number := l.printing.CollectorNumber
+	l.printing.CollectorNumber = ""
+	name := printingKey(l.name, l.printing)
+	if _, found := req.Cards[name]; found && (l.owner == "" || req.Owners[name] == nil || req.Owners[name][l.owner] > 0) {
+		req.issue(lineNo, SeverityWarning, "card %q is duplicated, copies are merged", name)
+	}
+	if !l.printing.empty() {
+		if req.Printings == nil {
+			req.Printings = make(map[string]Printing)
 		}
+		req.Printings[name] = l.printing
+	}
 
-		cards.Cards[name] = quantity
+	req.Cards[name] += l.quantity
+	if number != "" {
+		req.issue(lineNo, SeverityWarning, "collector number %s of %q is not matched, shops do not report collector numbers", number, l.name)
 	}
-	if err := scanner.Err(); err != nil {
-		logger.Warnw("Error reading body",
-			"err", err)
-		return nil, err
+	req.Lines = append(req.Lines, ListLine{Name: l.name, Quantity: l.quantity, Line: lineNo, Set: l.printing.Set, CollectorNumber: number})
+	if l.owner != "" {
+		if req.Owners == nil {
+			req.Owners = make(map[string]map[string]int)
+		}
+		if req.Owners[name] == nil {
+			req.Owners[name] = make(map[string]int)
+		}
+		req.Owners[name][l.owner] += l.quantity
+	}
+	if l.prio != nil {
+		if req.Priorities == nil {
+			req.Priorities = make(map[string]Priority)
+		}
+		// the card is as wanted as the most wanting line wants it
+		if old, found := req.Priorities[name]; !found || l.prio.Must || (!old.Must && l.prio.weight() > old.weight()) {
+			req.Priorities[name] = *l.prio
+		}
+	}
+}
+
+// RequestLine is a request line in a structured form, e.g. in a JSON request.
+type RequestLine struct {
+	Name string `json:"name"`
+	// Quantity is 1 if 0
+	Quantity int      `json:"quantity"`
+	Printing Printing `json:"printing"`
+	// Priority is "must", "nice" or a weight, see ParsePriority
+	Priority string `json:"priority"`
+	Owner    string `json:"owner"`
+}
+
+// ParseLines builds a request from structured lines the same way ParseTextMode does from text ones.
+// Issues refer to lines by their positions starting from 1.
+func ParseLines(lines []RequestLine, mode ValidationMode) (NamesRequest, error) {
+	req := NewNamesRequest()
+	for i, line := range lines {
+		l := textLine{
+			name:     strings.TrimSpace(line.Name),
+			quantity: line.Quantity,
+			owner:    line.Owner,
+			printing: line.Printing,
+		}
+		if l.quantity == 0 {
+			l.quantity = 1
+		}
+		if l.name == "" {
+			req.issue(i+1, SeverityError, "empty cardname")
+			continue
+		}
+		if l.quantity < 0 {
+			req.issue(i+1, SeverityError, "illegal quantity for card %q has been requested: %d", l.name, l.quantity)
+			continue
+		}
+		if line.Priority != "" {
+			p, err := ParsePriority(line.Priority)
+			if err != nil {
+				req.issue(i+1, SeverityError, "%s", err)
+				continue
+			}
+			l.prio = &p
+		}
+		req.addTextLine(i+1, l)
 	}
+	return req.validate(mode)
+}
+
+func ProcessText(r io.Reader) (*NamesResult, error) {
+	return ProcessTextContext(context.Background(), r)
+}
+
+// ProcessTextContext is like ProcessText but stops scraping once ctx is done, see ProcessByNamesContext.
+func ProcessTextContext(ctx context.Context, r io.Reader) (*NamesResult, error) {
+	return ProcessTextMode(ctx, r, ValidationStrict)
+}
 
-	if len(cards.Cards) == 0 {
-		logger.Warnw("Empty card list")
-		return nil, fmt.Errorf("Empty card list")
+// ProcessTextMode is like ProcessTextContext but lets lines with errors be skipped, see ParseTextMode.
+func ProcessTextMode(ctx context.Context, r io.Reader, mode ValidationMode) (*NamesResult, error) {
+	cards, err := ParseTextMode(r, mode)
+	if err != nil {
+		return nil, err
 	}
 
-	result, err := ProcessByNames(cards)
+	result, err := ProcessByNamesContext(ctx, cards)
 	if err != nil {
 		logger.Warnw("Could not process request",
 			"err", err)
-		return nil, err
+		return result, err
 	}
 
 	return result, nil
 }
 
-func calcGreedyMinPrices(req NamesRequest, cards map[string]CardResult) (map[string][]CardPrice, error) {
-	result := make(map[string][]CardPrice, len(req.Cards))
+func unknownCard(lib Library, name string) UnknownCard {
+	card := UnknownCard{Name: name}
+	if sug, ok := lib.(Suggester); ok {
+		card.Suggestions = sug.Suggest(name, maxSuggestions)
+	}
+	return card
+}
 
+// findUnavailable lists cards which have fewer copies in stock than requested.
+func findUnavailable(req NamesRequest, cards map[string]CardResult) []UnavailableCard {
+	var result []UnavailableCard
 	for name, reqCount := range req.Cards {
-		cardData, found := cards[name]
-		if !found {
-			return nil, fmt.Errorf("Card %q not found", name)
+		stock := 0
+		for _, p := range cards[name].Prices {
+			stock += p.Quantity
 		}
-
-		if !cardData.Available {
-			return nil, fmt.Errorf("Card %q is not available", name)
+		if stock < reqCount {
+			logger.Warnw("card is not available in requested quantity",
+				"name", name,
+				"requested", reqCount,
+				"stock", stock)
+			result = append(result, UnavailableCard{
+				Name:      name,
+				Requested: reqCount,
+				Missing:   reqCount - stock,
+			})
 		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
 
+// calcGreedyMinPrices takes the cheapest offers of every card until the requested quantity is collected
+// or offers are over.
+func calcGreedyMinPrices(req NamesRequest, cards map[string]CardResult) map[string][]CardPrice {
+	result := make(map[string][]CardPrice, len(req.Cards))
+
+	for name, reqCount := range req.Cards {
 		cardsFound := 0
-		for _, p := range cardData.Prices {
+		for _, p := range cards[name].Prices {
 			if cardsFound >= reqCount {
 				break
 			}
+			if p.Quantity <= 0 {
+				continue
+			}
 			toAdd := p
 			if toAdd.Quantity > reqCount-cardsFound {
 				toAdd.Quantity = reqCount - cardsFound
@@ -332,150 +761,23 @@ func calcGreedyMinPrices(req NamesRequest, cards map[string]CardResult) (map[str
 		}
 	}
 
-	return result, nil
+	return result
 }
 
-func fillMinPricesMatrix(cards map[string]CardResult) *PossessionMatrix {
+// fillMinPricesMatrix reports actual prices, preferences of sellers only order them
+func fillMinPricesMatrix(cards map[string]CardResult, sellers *SellerPolicy) *PossessionMatrix {
 	m := NewPossessionMatrix()
 	for c, res := range cards {
 		for _, p := range res.Prices {
 			m.AddCard(p.SellerFullName(), c, int(p.Price))
 		}
 	}
-	return m
-}
-
-func evaluateConsideringDelivery(req NamesRequest, cards map[string]CardResult, minPrices map[string][]CardPrice) (map[string]CardPrice, error) {
-	sellerCards := make(map[string]map[string]bool) // trader -> cardnames -> true
-	cardSellers := make(map[string]map[string]bool) // cardname -> traders -> true
-	cardSellerMinPrice := make(map[sellerCardPair]float32)
-	sellersWithUniqueCards := make(map[string][]string) // trader -> cardnames
-	for cardname, res := range cards {
-		if !res.Available {
-			logger.Debugw("delivery calc card not available",
-				"card", cardname)
-		}
-
-		cardSellers[cardname] = make(map[string]bool)
-
-		sellers := make(map[string]struct{})
-		for _, cardprice := range res.Prices {
-			trader := cardprice.Trader
-			cardSellers[cardname][trader] = true
-			if _, found := sellerCards[trader]; !found {
-				sellerCards[trader] = make(map[string]bool, len(cards))
-			}
-			sellerCards[trader][cardname] = true
-			sellers[trader] = struct{}{}
-
-			pair := sellerCardPair{seller: trader, cardname: cardname}
-			price := cardSellerMinPrice[pair]
-			if price == 0 || price > cardprice.Price {
-				cardSellerMinPrice[pair] = cardprice.Price
-				logger.Debugw("card seller new min price",
-					"card", cardname,
-					"seller", trader,
-					"price", cardprice.Price)
-			}
-		}
-
-		if len(sellers) == 1 {
-			uniqueSeller := ""
-			for s := range sellers {
-				uniqueSeller = s
-			}
-			sellersWithUniqueCards[uniqueSeller] = append(sellersWithUniqueCards[uniqueSeller], cardname)
-			logger.Debugw("trader uniquely sells a card",
-				"trader", uniqueSeller,
-				"card", cardname)
+	for seller, prices := range m.SellerCards {
+		var total float32
+		for _, price := range prices {
+			total += sellers.weigh(seller, float32(price))
 		}
+		m.ComparedTotals[seller] = int(total)
 	}
-	logger.Debugw("stats collected",
-		"totalSellers", len(sellerCards),
-		"totalUniqueSellers", len(sellersWithUniqueCards))
-
-	evalData := deliveryEvalData{
-		deliveryFee:        req.DeliveryFee,
-		cards:              cards,
-		sellerCards:        sellerCards,
-		cardSellers:        cardSellers,
-		sellerCardMinPrice: cardSellerMinPrice,
-	}
-	evaluateDeliveryViaPermutation(evalData)
-
-	return nil, nil
-}
-
-type sellerCardPair struct {
-	seller, cardname string
-}
-
-type deliveryEvalData struct {
-	deliveryFee              int
-	cards                    map[string]CardResult
-	sellerCards, cardSellers map[string]map[string]bool
-	sellerCardMinPrice       map[sellerCardPair]float32
-}
-
-func evaluateDeliveryViaPermutation(data deliveryEvalData) (int, []sellerCardPair) {
-	cost, result := iteratePermutation(map[string]bool{}, []sellerCardPair{}, data)
-	logger.Debugw("permutation best result",
-		"cost", cost)
-	return cost, result
-}
-
-func iteratePermutation(cardsPicked map[string]bool, resultSet []sellerCardPair, data deliveryEvalData) (int, []sellerCardPair) {
-	if len(cardsPicked) == len(data.cards) {
-		cost := 0
-		sellersMet := make(map[string]bool)
-		for _, cs := range resultSet {
-			cost += int(data.sellerCardMinPrice[cs])
-			if !sellersMet[cs.seller] {
-				sellersMet[cs.seller] = true
-				cost += data.deliveryFee
-			}
-		}
-		logger.Debugw("permutation end",
-			"cost", cost)
-		return cost, resultSet
-	}
-
-	bestCost := math.MaxInt32
-	var bestResult []sellerCardPair
-	for card := range data.cards {
-		if cardsPicked[card] {
-			logger.Debugw("card already picked",
-				"card", card,
-				"picked", len(cardsPicked))
-			continue
-		}
-		cardsPicked[card] = true
-		logger.Debugw("card picked",
-			"card", card,
-			"picked", len(cardsPicked))
-		for seller := range data.cardSellers[card] {
-			logger.Debugw("seller picked",
-				"card", card,
-				"picked", len(cardsPicked),
-				"seller", seller)
-			resultSet = append(resultSet, sellerCardPair{seller: seller, cardname: card})
-			price, rs := iteratePermutation(cardsPicked, resultSet, data)
-			if price < bestCost {
-				logger.Debugw("permutation better result",
-					"cost", price,
-					"cards picked", len(cardsPicked),
-					"card", card,
-					"seller", seller)
-				bestCost = price
-				bestResult = rs
-			}
-			resultSet = resultSet[0 : len(resultSet)-1]
-		}
-		delete(cardsPicked, card)
-	}
-
-	logger.Debugw("permutation exhausted",
-		"cost", bestCost,
-		"picked", len(cardsPicked))
-	return bestCost, bestResult
+	return m
 }
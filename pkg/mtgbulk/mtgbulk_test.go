@@ -0,0 +1,268 @@
+package mtgbulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestLibrary makes requests use the library of testdata/library.json instead of the Scryfall dump
+func useTestLibrary(t *testing.T) Library {
+	t.Helper()
+	lib, err := NewInMemoryLibrary(filepath.Join("testdata", "library.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	useLibrary(t, lib)
+	return lib
+}
+
+// useLibrary makes requests of the test use lib
+func useLibrary(t *testing.T, lib Library) {
+	old := cardLib
+	SetLibrary(lib)
+	t.Cleanup(func() { cardLib = old })
+}
+
+// stubLibrary knows only its names and suggests what it is told to
+type stubLibrary struct {
+	names       []string
+	suggestions map[string][]string
+}
+
+func (lib *stubLibrary) CardAliases(name string) (map[string]bool, error) {
+	for _, known := range lib.names {
+		if known == name {
+			return map[string]bool{strings.ToLower(name): true}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown card %q", name)
+}
+
+func (lib *stubLibrary) EnglishName(name string) (string, error) {
+	if _, err := lib.CardAliases(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (lib *stubLibrary) Suggest(name string, n int) []string {
+	sug := lib.suggestions[name]
+	if len(sug) > n {
+		sug = sug[:n]
+	}
+	return sug
+}
+
+// offersSearcher finds offers of a single shop, keyed by card name
+func offersSearcher(name string, offers map[string][]CardPrice) Searcher {
+	return &fakeSearcher{name: name, search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		res := newCardResult()
+		for _, cp := range offers[q.Name] {
+			cp.Platform = MtgSale
+			cp.Trader = name
+			res.Prices = append(res.Prices, cp)
+		}
+		res.Available = len(res.Prices) > 0
+		return res, nil
+	}}
+}
+
+// blockedSearcher never finds anything until ctx is done
+func blockedSearcher(name string) Searcher {
+	return &fakeSearcher{name: name, search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		<-ctx.Done()
+		return newCardResult(), ctx.Err()
+	}}
+}
+
+func TestProcessInterruptedSearchFitsBudget(t *testing.T) {
+	useTestLibrary(t)
+	registry := NewRegistry()
+	registry.Register(offersSearcher("fast", map[string][]CardPrice{
+		"Lightning Bolt": {{Price: 10, Quantity: 4}},
+		"Counterspell":   {{Price: 30, Quantity: 4}},
+		"Shock":          {{Price: 5, Quantity: 1}},
+	}))
+	registry.Register(blockedSearcher("slow"))
+
+	req, err := ParseText(strings.NewReader("2 Lightning Bolt [must] @alice\n2 Counterspell @bob\n3 Shock\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	req.Searchers = registry
+	req.Budget = 50
+	req.Timeout = 100 * time.Millisecond
+
+	result, err := ProcessByNamesContext(context.Background(), req)
+	if !errors.Is(err, context.DeadlineExceeded) || result == nil {
+		t.Fatalf("a partial result and a deadline error are expected, got %v", err)
+	}
+
+	var spent float32
+	for _, prices := range result.MinPricesNoDelivery {
+		for _, cp := range prices {
+			spent += cp.Price * float32(cp.Quantity)
+		}
+	}
+	if spent != 25 {
+		t.Errorf("2 Lightning Bolts and 1 Shock for 25 are expected within the budget, got %v: %v", spent, result.MinPricesNoDelivery)
+	}
+	if want := map[string]int{"Counterspell": 2}; !reflect.DeepEqual(result.Deferred, want) {
+		t.Errorf("expected deferred %v, got %v", want, result.Deferred)
+	}
+	if want := []UnavailableCard{{Name: "Shock", Requested: 3, Missing: 2}}; !reflect.DeepEqual(result.Unavailable, want) {
+		t.Errorf("expected unavailable %v, got %v", want, result.Unavailable)
+	}
+	if got := billPrices(result.Bills); !reflect.DeepEqual(got, map[string][]float32{"alice": {10, 10}, Unassigned: {5}}) {
+		t.Errorf("unexpected bills %v", got)
+	}
+	if !result.Incomplete() {
+		t.Error("the result is expected to be incomplete")
+	}
+}
+
+func TestProcessInterruptedSearchReportsBudgetError(t *testing.T) {
+	useTestLibrary(t)
+	registry := NewRegistry()
+	registry.Register(offersSearcher("fast", map[string][]CardPrice{
+		"Lightning Bolt": {{Price: 10, Quantity: 4}},
+	}))
+	registry.Register(blockedSearcher("slow"))
+
+	req, err := ParseText(strings.NewReader("4 Lightning Bolt [must]\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	req.Searchers = registry
+	req.Budget = 30
+	req.Timeout = 100 * time.Millisecond
+
+	_, err = ProcessByNamesContext(context.Background(), req)
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Errorf("BudgetError is expected instead of a result over the budget, got %v", err)
+	}
+}
+
+func TestProcessCancelledSearchReturnsPartialResult(t *testing.T) {
+	useTestLibrary(t)
+	cancelled := make(chan string, 1)
+	srv := newBlockingServer(t, cancelled)
+	defer srv.Close()
+	registry := NewRegistry()
+	registry.Register(NewMtgTradeSearcher(SearcherOptions{BaseURL: srv.URL, HTTP: &HTTPPolicy{}}))
+
+	req, err := ParseText(strings.NewReader("4 Lightning Bolt\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	req.Searchers = registry
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	result, err := ProcessByNamesContext(ctx, req)
+	if !errors.Is(err, context.Canceled) || result == nil {
+		t.Fatalf("a partial result and a cancellation error are expected, got %v", err)
+	}
+	if len(result.MinPricesNoDelivery["Lightning Bolt"]) == 0 {
+		t.Error("offers of the first page are expected")
+	}
+	if !result.Incomplete() {
+		t.Error("the result is expected to be incomplete")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("the request in flight is expected to be cancelled")
+	}
+}
+
+func TestProcessReportsUnknownAndUnavailable(t *testing.T) {
+	useLibrary(t, &stubLibrary{
+		names:       []string{"Lightning Bolt", "Counterspell", "Shock"},
+		suggestions: map[string][]string{"Lightnig Bolt": {"Lightning Bolt", "Lightning Helix"}},
+	})
+	offers := map[string][]CardPrice{
+		"Lightning Bolt": {{Price: 10, Quantity: 2}, {Price: 12, Quantity: 1}},
+		"Counterspell":   {{Price: 30, Quantity: 4}},
+	}
+
+	tests := []struct {
+		name        string
+		list        string
+		unknown     []UnknownCard
+		unavailable []UnavailableCard
+		bought      map[string]int
+	}{
+		{
+			name:   "everything in stock",
+			list:   "3 Lightning Bolt\n2 Counterspell\n",
+			bought: map[string]int{"Lightning Bolt": 3, "Counterspell": 2},
+		},
+		{
+			name:    "typo",
+			list:    "2 Lightnig Bolt\n2 Counterspell\n",
+			unknown: []UnknownCard{{Name: "Lightnig Bolt", Suggestions: []string{"Lightning Bolt", "Lightning Helix"}}},
+			bought:  map[string]int{"Counterspell": 2},
+		},
+		{
+			name:    "unknown without suggestions",
+			list:    "1 Black Lotus\n1 Counterspell\n",
+			unknown: []UnknownCard{{Name: "Black Lotus"}},
+			bought:  map[string]int{"Counterspell": 1},
+		},
+		{
+			name:        "short stock",
+			list:        "5 Lightning Bolt\n4 Counterspell\n",
+			unavailable: []UnavailableCard{{Name: "Lightning Bolt", Requested: 5, Missing: 2}},
+			bought:      map[string]int{"Lightning Bolt": 3, "Counterspell": 4},
+		},
+		{
+			name:        "no stock",
+			list:        "2 Shock\n1 Counterspell\n",
+			unavailable: []UnavailableCard{{Name: "Shock", Requested: 2, Missing: 2}},
+			bought:      map[string]int{"Counterspell": 1},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			registry := NewRegistry()
+			registry.Register(offersSearcher("shop", offers))
+			req, err := ParseText(strings.NewReader(tc.list))
+			if err != nil {
+				t.Fatalf("could not parse the list: %s", err)
+			}
+			req.Searchers = registry
+
+			result, err := ProcessByNamesContext(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Unknown, tc.unknown) {
+				t.Errorf("expected unknown %+v, got %+v", tc.unknown, result.Unknown)
+			}
+			if !reflect.DeepEqual(result.Unavailable, tc.unavailable) {
+				t.Errorf("expected unavailable %+v, got %+v", tc.unavailable, result.Unavailable)
+			}
+			bought := make(map[string]int)
+			for name, prices := range result.MinPricesNoDelivery {
+				for _, cp := range prices {
+					bought[name] += cp.Quantity
+				}
+			}
+			if !reflect.DeepEqual(bought, tc.bought) {
+				t.Errorf("expected bought %v, got %v", tc.bought, bought)
+			}
+		})
+	}
+}
@@ -1,80 +1,105 @@
 package mtgbulk
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gocolly/colly"
 )
 
-func searchMtgSale(cardname string) CardResult {
+const mtgSaleBaseURL = "https://mtgsale.ru"
+
+type mtgSaleSearcher struct {
+	platformSearcher
+}
+
+func NewMtgSaleSearcher(opts SearcherOptions) Searcher {
+	return &mtgSaleSearcher{
+		platformSearcher: newPlatformSearcher(MtgSale, mtgSaleBaseURL, opts),
+	}
+}
+
+func (s *mtgSaleSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q.Name)
+}
+
+func (s *mtgSaleSearcher) search(ctx context.Context, cardname string) (CardResult, error) {
 	result := newCardResult()
-	addr := mtgSaleSearchURL(cardname)
+	addr := mtgSaleSearchURL(s.baseURL, cardname)
 
-	c := colly.NewCollector()
-	c.SetRequestTimeout(20 * time.Second)
+	c := newCollector(ctx, s.transport)
+	diag := newSearchDiagnostics(MtgSale.String())
+	diag.trackResponses(c)
 	c.OnHTML(".ctclass", func(e *colly.HTMLElement) {
-		name1 := strings.ToLower(e.ChildText(".tnamec"))
-		name2 := strings.ToLower(e.ChildText(".smallfont"))
-		cardname := strings.ToLower(cardname)
-		logger.Debugw("parsing mtgsale card",
-			"name1", name1,
-			"name2", name2,
-			"cardname", cardname)
-		if name1 == cardname || name2 == cardname {
-			p := e.ChildText(".pprice")
-			p = strings.Trim(p, " ₽")
-			pVal, err := strconv.Atoi(p)
-			if err != nil {
-				logger.Errorw("Price cannot be parsed",
-					"card", cardname,
-					"price", p,
-					"err", err)
-				return
-			}
-
-			foil := false
-			if e.ChildText(".foil") != "" {
-				foil = true
-			}
-			count := e.ChildText(".colvo")
-			count = strings.Trim(count, " шт.")
-			countVal, err := strconv.Atoi(count)
-			if err != nil {
-				logger.Errorw("Count cannot be parsed",
-					"card", cardname,
-					"count", count,
-					"err", err)
-				return
-			}
+		price, matched, err := parseMtgSaleItem(e, cardname)
+		if err != nil {
+			logger.Errorw("mtgsale item cannot be parsed",
+				"card", cardname,
+				"err", err)
+			diag.RowsSkipped++
+			return
+		}
+		if !matched {
+			return
+		}
 
-			if countVal > 0 {
-				result.Available = true
-				result.Prices = append(result.Prices, CardPrice{
-					Price:    float32(pVal),
-					Foil:     foil,
-					Currency: RUR,
-					Quantity: countVal,
-					Platform: MtgSale,
-					Trader:   "mtgsale",
-					URL:      addr, // TODO: correct it! - there's a direct link to a card instead of a search
-				})
-			}
+		diag.RowsParsed++
+		if price.Quantity > 0 {
+			price.URL = addr // TODO: correct it! - there's a direct link to a card instead of a search
+			result.Available = true
+			result.Prices = append(result.Prices, price)
 		}
 	})
 
 	err := c.Visit(addr)
+	return finishSearch(ctx, result, diag, addr, err)
+}
+
+func mtgSaleSearchURL(baseURL, cardname string) string {
+	return fmt.Sprintf("%s/home/search-results?Name=%s&Lang=Any&Type=Any&Color=Any&Rarity=Any", baseURL, url.PathEscape(cardname))
+}
+
+// parseMtgSaleItem parses a single search result. matched is false if the item is some other card.
+func parseMtgSaleItem(e *colly.HTMLElement, cardname string) (price CardPrice, matched bool, err error) {
+	name1 := strings.ToLower(e.ChildText(".tnamec"))
+	name2 := strings.ToLower(e.ChildText(".smallfont"))
+	cardname = strings.ToLower(cardname)
+	logger.Debugw("parsing mtgsale card",
+		"name1", name1,
+		"name2", name2,
+		"cardname", cardname)
+	if name1 != cardname && name2 != cardname {
+		return price, false, nil
+	}
+
+	p := e.ChildText(".pprice")
+	p = strings.Trim(p, " ₽")
+	pVal, err := strconv.Atoi(p)
 	if err != nil {
-		logger.Errorw("Unable to visit with scraper",
-			"url", addr,
-			"err", err)
+		return price, true, fmt.Errorf("price %q cannot be parsed: %w", p, err)
+	}
+
+	foil := false
+	if e.ChildText(".foil") != "" {
+		foil = true
+	}
+	count := e.ChildText(".colvo")
+	count = strings.Trim(count, " шт.")
+	countVal, err := strconv.Atoi(count)
+	if err != nil {
+		return price, true, fmt.Errorf("count %q cannot be parsed: %w", count, err)
 	}
-	return result
-}
 
-func mtgSaleSearchURL(cardname string) string {
-	return fmt.Sprintf("https://mtgsale.ru/home/search-results?Name=%s&Lang=Any&Type=Any&Color=Any&Rarity=Any", url.PathEscape(cardname))
+	return CardPrice{
+		Price:    float32(pVal),
+		Foil:     foil,
+		Currency: RUR,
+		Quantity: countVal,
+		Edition:  strings.TrimSpace(e.ChildText(".nabor")),
+		Platform: MtgSale,
+		Trader:   "mtgsale",
+	}, true, nil
 }
@@ -1,91 +1,52 @@
 package mtgbulk
 
 import (
+	"context"
 	"fmt"
-	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gocolly/colly"
 )
 
-func searchMtgTrade(cardname string) CardResult {
+const mtgTradeBaseURL = "http://mtgtrade.net"
+
+type mtgTradeSearcher struct {
+	platformSearcher
+}
+
+func NewMtgTradeSearcher(opts SearcherOptions) Searcher {
+	return &mtgTradeSearcher{
+		platformSearcher: newPlatformSearcher(MtgTrade, mtgTradeBaseURL, opts),
+	}
+}
+
+func (s *mtgTradeSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q.Name)
+}
+
+func (s *mtgTradeSearcher) search(ctx context.Context, cardname string) (CardResult, error) {
 	cardname = strings.ToLower(cardname)
 	result := newCardResult()
-	addr := mtgTradeSearchURL(cardname)
+	addr := mtgTradeSearchURL(s.baseURL, cardname)
 
 	visitedPages := make(map[string]bool)
-	c := colly.NewCollector()
-	defCopy := *(http.DefaultTransport.(*http.Transport))
-	var tr *http.Transport = &defCopy
-	tr.ResponseHeaderTimeout = 20 * time.Second
-	c.WithTransport(tr)
+	c := newCollector(ctx, s.transport)
+	diag := newSearchDiagnostics(MtgTrade.String())
+	diag.trackResponses(c)
 	c.OnHTML(".search-item", func(e *colly.HTMLElement) {
-		nameEn := strings.ToLower(e.ChildText(".catalog-title"))
-		if nameEn != cardname {
-			matched := false
-			e.ForEach("p", func(i int, eP *colly.HTMLElement) {
-				if !matched {
-					nameRu := strings.ToLower(strings.TrimSpace(eP.Text))
-					logger.Debugw("search item analyze Russian name",
-						"cardname", cardname,
-						"nameEn", nameEn,
-						"nameRu", nameRu)
-					if nameRu == cardname {
-						matched = true
-					}
-				}
-			})
-
-			if !matched {
-				return
-			}
+		if !mtgTradeItemMatches(e, cardname) {
+			return
 		}
 
-		e.ForEach("table.search-card", func(i int, eTable *colly.HTMLElement) {
-			trader := eTable.ChildText("tbody .trader-name a")
-
-			eTable.ForEach("tbody tr", func(i int, eTR *colly.HTMLElement) {
-				price, err := strconv.ParseFloat(eTR.ChildText(".catalog-rate-price"), 32)
-				if err != nil {
-					logger.Errorw("card price convert failed",
-						"err", err)
-					return
-				}
-
-				quantity, err := strconv.Atoi(eTR.ChildText(".sale-count"))
-				if err != nil {
-					logger.Errorw("card count convert failed",
-						"err", err)
-					return
-				}
-
-				foil := false
-				if eTR.ChildAttr("img.foil", "src") != "" {
-					foil = true
-				}
-
-				logger.Debugw("card",
-					"row_index", i,
-					"trader", trader,
-					"price", price,
-					"count", quantity,
-					"foil", foil,
-					"quality", eTR.ChildText(".js-card-quality-tooltip")) // TODO: to CardPrice
-
-				result.Available = true
-				result.Prices = append(result.Prices, CardPrice{
-					Price:    float32(price),
-					Foil:     foil,
-					Currency: RUR,
-					Quantity: quantity,
-					Platform: MtgTrade,
-					Trader:   trader,
-					URL:      addr, // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
-				})
-			})
-		})
+		prices, skipped := parseMtgTradeItem(e)
+		diag.RowsSkipped += skipped
+		diag.RowsParsed += len(prices)
+		for _, p := range prices {
+			p.URL = addr // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
+			result.Available = true
+			result.Prices = append(result.Prices, p)
+		}
 	})
 
 	c.OnHTML("span.pagination-item", func(e *colly.HTMLElement) {
@@ -105,19 +66,90 @@ func searchMtgTrade(cardname string) CardResult {
 		logger.Debugw("Visiting page",
 			"page", page,
 			"url", url)
-		e.Request.Visit(url)
+		if err := e.Request.Visit(url); err != nil && err != colly.ErrAlreadyVisited && diag.Status == SearchOK {
+			diag.setError(fmt.Errorf("unable to visit %s: %w", url, err))
+		}
 	})
 
 	err := c.Visit(addr)
-	if err != nil {
-		logger.Errorw("Unable to visit with scraper",
-			"url", addr,
-			"err", err)
-	}
-	return result
+	return finishSearch(ctx, result, diag, addr, err)
 }
 
-func mtgTradeSearchURL(cardname string) string {
+func mtgTradeSearchURL(baseURL, cardname string) string {
 	cardname = strings.ReplaceAll(cardname, " ", "+")
-	return fmt.Sprintf("http://mtgtrade.net/search/?query=%s", cardname)
+	return fmt.Sprintf("%s/search/?query=%s", baseURL, cardname)
+}
+
+// mtgTradeItemMatches checks whether a search result is the requested card by its English or Russian name.
+func mtgTradeItemMatches(e *colly.HTMLElement, cardname string) bool {
+	nameEn := strings.ToLower(e.ChildText(".catalog-title"))
+	if nameEn == cardname {
+		return true
+	}
+
+	matched := false
+	e.ForEach("p", func(i int, eP *colly.HTMLElement) {
+		if !matched {
+			nameRu := strings.ToLower(strings.TrimSpace(eP.Text))
+			logger.Debugw("search item analyze Russian name",
+				"cardname", cardname,
+				"nameEn", nameEn,
+				"nameRu", nameRu)
+			if nameRu == cardname {
+				matched = true
+			}
+		}
+	})
+	return matched
+}
+
+// parseMtgTradeItem parses offers of all traders of a single search result.
+// skipped is the number of offers which could not be parsed.
+func parseMtgTradeItem(e *colly.HTMLElement) (prices []CardPrice, skipped int) {
+	e.ForEach("table.search-card", func(i int, eTable *colly.HTMLElement) {
+		trader := eTable.ChildText("tbody .trader-name a")
+
+		eTable.ForEach("tbody tr", func(i int, eTR *colly.HTMLElement) {
+			price, err := strconv.ParseFloat(eTR.ChildText(".catalog-rate-price"), 32)
+			if err != nil {
+				logger.Errorw("card price convert failed",
+					"err", err)
+				skipped++
+				return
+			}
+
+			quantity, err := strconv.Atoi(eTR.ChildText(".sale-count"))
+			if err != nil {
+				logger.Errorw("card count convert failed",
+					"err", err)
+				skipped++
+				return
+			}
+
+			foil := false
+			if eTR.ChildAttr("img.foil", "src") != "" {
+				foil = true
+			}
+
+			logger.Debugw("card",
+				"row_index", i,
+				"trader", trader,
+				"price", price,
+				"count", quantity,
+				"foil", foil,
+				"quality", eTR.ChildText(".js-card-quality-tooltip")) // TODO: to CardPrice
+
+			prices = append(prices, CardPrice{
+				Price:    float32(price),
+				Foil:     foil,
+				Currency: RUR,
+				Quantity: quantity,
+				Edition:  strings.TrimSpace(eTR.ChildText(".search-card-set")),
+				Language: strings.ToLower(strings.TrimSpace(eTR.ChildText(".search-card-lang"))),
+				Platform: MtgTrade,
+				Trader:   trader,
+			})
+		})
+	})
+	return prices, skipped
 }
@@ -12,12 +12,16 @@ import (
 type PossessionMatrix struct {
 	SellerCards map[string]map[string]int
 	CardSellers map[string]map[string]int
+	// ComparedTotals are totals of sellers as preferences of SellerPolicy weight them.
+	// They order sellers with the same number of cards
+	ComparedTotals map[string]int
 }
 
 func NewPossessionMatrix() *PossessionMatrix {
 	return &PossessionMatrix{
-		SellerCards: make(map[string]map[string]int),
-		CardSellers: make(map[string]map[string]int),
+		SellerCards:    make(map[string]map[string]int),
+		CardSellers:    make(map[string]map[string]int),
+		ComparedTotals: make(map[string]int),
 	}
 }
 
@@ -69,7 +73,14 @@ func NewPossessionTable(m *PossessionMatrix) *PossessionTable {
 		t.Sellers = append(t.Sellers, seller)
 	}
 	sort.Slice(t.Sellers, func(i, j int) bool {
-		return len(m.SellerCards[t.Sellers[i]]) >= len(m.SellerCards[t.Sellers[j]])
+		a, b := t.Sellers[i], t.Sellers[j]
+		if len(m.SellerCards[a]) != len(m.SellerCards[b]) {
+			return len(m.SellerCards[a]) > len(m.SellerCards[b])
+		}
+		if m.ComparedTotals[a] != m.ComparedTotals[b] {
+			return m.ComparedTotals[a] < m.ComparedTotals[b]
+		}
+		return a < b
 	})
 
 	for card := range m.CardSellers {
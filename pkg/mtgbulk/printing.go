@@ -0,0 +1,199 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Printing narrows a request line down to specific printings of a card. Empty fields mean any.
+// An offer satisfies a constraint only if the shop tells it does, e.g. offers without an edition
+// are dropped if Set is required and offers of unknown foiling are dropped if Foil is.
+type Printing struct {
+	// Set is a set code like "3ED" or a set name like "Revised Edition"
+	Set string `json:"set,omitempty"`
+	// Foil requires foil copies if true and non-foil ones if false
+	Foil *bool `json:"foil,omitempty"`
+	// Language is a language code like "en" or "ru"
+	Language string `json:"language,omitempty"`
+	// CollectorNumber is kept on the line but not matched as no shop reports collector numbers
+	CollectorNumber string `json:"collector_number,omitempty"`
+}
+
+// SetNamer is implemented by libraries which know names of sets, so set codes can be matched against
+// editions written by shops.
+type SetNamer interface {
+	// SetName returns the name of the set with the code
+	SetName(code string) (string, bool)
+}
+
+// ParsePrinting reads constraints like "set=3ED foil lang=en number=146", separated by spaces or commas.
+// "nonfoil" requires non-foil copies.
+func ParsePrinting(s string) (Printing, error) {
+	var p Printing
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, f := range fields {
+		key, value := f, ""
+		if i := strings.IndexAny(f, "=:"); i >= 0 {
+			key, value = f[:i], f[i+1:]
+		}
+		key = strings.ToLower(key)
+		if value == "" && key != "foil" && key != "nonfoil" {
+			return p, fmt.Errorf("printing constraint %q has no value", f)
+		}
+		switch key {
+		case "set", "edition":
+			p.Set = value
+		case "number", "cn", "collector_number":
+			p.CollectorNumber = value
+		case "lang", "language":
+			p.Language = strings.ToLower(value)
+		case "foil":
+			foil := true
+			p.Foil = &foil
+		case "nonfoil":
+			foil := false
+			p.Foil = &foil
+		default:
+			return p, fmt.Errorf("unknown printing constraint %q", f)
+		}
+	}
+	return p, nil
+}
+
+// empty tells whether offers are not filtered at all, the collector number does not count.
+func (p Printing) empty() bool {
+	return p.Set == "" && p.Foil == nil && p.Language == ""
+}
+
+// String writes the constraints in a canonical form, so equal printings are written the same.
+// The collector number is left out as it is not matched.
+func (p Printing) String() string {
+	var fields []string
+	if p.Set != "" {
+		fields = append(fields, "set="+p.Set)
+	}
+	if p.Language != "" {
+		fields = append(fields, "lang="+strings.ToLower(p.Language))
+	}
+	if p.Foil != nil {
+		if *p.Foil {
+			fields = append(fields, "foil")
+		} else {
+			fields = append(fields, "nonfoil")
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// printingKey is the request key of a line: the card name, followed by the printing in braces if there is one.
+func printingKey(name string, p Printing) string {
+	if p.empty() {
+		return name
+	}
+	return name + " {" + p.String() + "}"
+}
+
+// cardName returns the card name of a request key, see printingKey.
+func cardName(key string) string {
+	if m := printingRe.FindStringSubmatch(key); m != nil {
+		return m[1]
+	}
+	return key
+}
+
+// matches tells whether the offer is known to satisfy every constraint but the collector number.
+// setName is the name of p.Set if it is a known set code.
+func (p Printing) matches(cp CardPrice, setName string) bool {
+	if p.Foil != nil && (cp.FoilUnknown || cp.Foil != *p.Foil) {
+		return false
+	}
+	if p.Language != "" && !strings.EqualFold(cp.Language, p.Language) {
+		return false
+	}
+	if p.Set != "" {
+		edition := strings.TrimSpace(cp.Edition)
+		if edition == "" {
+			return false
+		}
+		if !strings.EqualFold(edition, p.Set) && (setName == "" || !strings.EqualFold(edition, setName)) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyPrintings makes offers of every request line out of offers of its card: request key -> offers.
+// Lines of the same card share its stock: lines with printings reserve the cheapest matching copies in order
+// of keys and are limited to them, a line without a printing gets the rest. A line is not available if no offers are left.
+func applyPrintings(lib Library, req NamesRequest, cards map[string]CardResult) map[string]CardResult {
+	byName := make(map[string][]string)
+	for key := range req.Cards {
+		name := cardName(key)
+		byName[name] = append(byName[name], key)
+	}
+	result := make(map[string]CardResult, len(req.Cards))
+	for name, keys := range byName {
+		res, found := cards[name]
+		if !found {
+			continue
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ei, ej := req.Printings[keys[i]].empty(), req.Printings[keys[j]].empty()
+			if ei != ej {
+				return ej
+			}
+			return keys[i] < keys[j]
+		})
+		stock := make([]int, len(res.Prices))
+		for i, cp := range res.Prices {
+			stock[i] = cp.Quantity
+		}
+		for k, key := range keys {
+			p := req.Printings[key]
+			setName := ""
+			if namer, ok := lib.(SetNamer); ok && p.Set != "" {
+				setName, _ = namer.SetName(p.Set)
+			}
+			last := k == len(keys)-1
+			need := req.Cards[key]
+			filtered := res
+			filtered.Prices = nil
+			for i, cp := range res.Prices {
+				if stock[i] <= 0 || !p.matches(cp, setName) {
+					continue
+				}
+				if last {
+					cp.Quantity = stock[i]
+				} else {
+					if need <= 0 {
+						continue
+					}
+					cp.Quantity = stock[i]
+					if cp.Quantity > need {
+						cp.Quantity = need
+					}
+					stock[i] -= cp.Quantity
+					need -= cp.Quantity
+				}
+				filtered.Prices = append(filtered.Prices, cp)
+			}
+			filtered.Available = res.Available && len(filtered.Prices) > 0
+			result[key] = filtered
+		}
+	}
+	return result
+}
+
+// nameLanguage guesses the language of a printing by its name, only English and Russian are told apart.
+func nameLanguage(name string) string {
+	for _, r := range name {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return "ru"
+		}
+	}
+	return "en"
+}
@@ -0,0 +1,190 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setLibrary knows names of sets only
+type setLibrary map[string]string
+
+func (setLibrary) CardAliases(string) (map[string]bool, error) {
+	return nil, fmt.Errorf("not a card library")
+}
+
+func (setLibrary) EnglishName(string) (string, error) {
+	return "", fmt.Errorf("not a card library")
+}
+
+func (l setLibrary) SetName(code string) (string, bool) {
+	name, found := l[strings.ToUpper(code)]
+	return name, found
+}
+
+func TestParsePrinting(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		in   string
+		want Printing
+		err  bool
+	}{
+		{in: "", want: Printing{}},
+		{in: "set=3ED", want: Printing{Set: "3ED"}},
+		{in: "edition:Revised lang=EN", want: Printing{Set: "Revised", Language: "en"}},
+		{in: "set=M10, foil", want: Printing{Set: "M10", Foil: &yes}},
+		{in: "nonfoil language=ru", want: Printing{Foil: &no, Language: "ru"}},
+		{in: "set=M10 number=146", want: Printing{Set: "M10", CollectorNumber: "146"}},
+		{in: "cn:146", want: Printing{CollectorNumber: "146"}},
+		{in: "set=", err: true},
+		{in: "frame=old", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePrinting(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: error is expected, got %+v", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %+v, got %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestPrintingKey(t *testing.T) {
+	foil := true
+	for _, tt := range []struct {
+		p    Printing
+		want string
+	}{
+		{Printing{}, "Volcanic Island"},
+		{Printing{Set: "3ED"}, "Volcanic Island {set=3ED}"},
+		{Printing{Foil: &foil, Language: "EN", Set: "3ED"}, "Volcanic Island {set=3ED lang=en foil}"},
+	} {
+		key := printingKey("Volcanic Island", tt.p)
+		if key != tt.want {
+			t.Errorf("%+v: expected key %q, got %q", tt.p, tt.want, key)
+		}
+		if name := cardName(key); name != "Volcanic Island" {
+			t.Errorf("%q: unexpected card name %q", key, name)
+		}
+	}
+}
+
+func TestApplyPrintingsFiltersOffers(t *testing.T) {
+	lib := setLibrary{"3ED": "Revised Edition"}
+	cards := map[string]CardResult{
+		"Volcanic Island": {Available: true, Prices: []CardPrice{
+			{Price: 100, Quantity: 1, Trader: "a", Edition: "Revised Edition", Language: "en"},
+			{Price: 200, Quantity: 1, Trader: "b", Edition: "3ED", Language: "ru"},
+			{Price: 300, Quantity: 1, Trader: "c"},
+			{Price: 400, Quantity: 1, Trader: "d", Edition: "Unlimited Edition", Language: "en", Foil: true},
+			{Price: 500, Quantity: 1, Trader: "e", Language: "en", FoilUnknown: true},
+		}},
+	}
+	yes, no := true, false
+	tests := []struct {
+		p    Printing
+		want []string
+	}{
+		{Printing{}, []string{"a", "b", "c", "d", "e"}},
+		{Printing{Set: "3ED"}, []string{"a", "b"}},
+		{Printing{Set: "revised edition"}, []string{"a"}},
+		{Printing{Language: "en"}, []string{"a", "d", "e"}},
+		{Printing{Foil: &yes}, []string{"d"}},
+		{Printing{Foil: &no}, []string{"a", "b", "c"}},
+		{Printing{CollectorNumber: "146"}, []string{"a", "b", "c", "d", "e"}},
+		{Printing{Set: "3ED", Foil: &yes}, nil},
+	}
+	for _, tt := range tests {
+		key := printingKey("Volcanic Island", tt.p)
+		req := NamesRequest{
+			Cards:     map[string]int{key: 1},
+			Printings: map[string]Printing{key: tt.p},
+		}
+		res := applyPrintings(lib, req, cards)[key]
+		var traders []string
+		for _, cp := range res.Prices {
+			traders = append(traders, cp.Trader)
+		}
+		if !reflect.DeepEqual(traders, tt.want) {
+			t.Errorf("%+v: expected offers of %v, got %v", tt.p, tt.want, traders)
+		}
+		if res.Available != (len(tt.want) > 0) {
+			t.Errorf("%+v: unexpected availability %v", tt.p, res.Available)
+		}
+	}
+}
+
+func TestApplyPrintingsSharesStock(t *testing.T) {
+	cards := map[string]CardResult{
+		"Volcanic Island": {Available: true, Prices: []CardPrice{
+			{Price: 100, Quantity: 2, Trader: "a"},
+			{Price: 150, Quantity: 2, Trader: "b", Edition: "3ED"},
+			{Price: 200, Quantity: 3, Trader: "c", Edition: "3ED"},
+		}},
+	}
+	req, err := ParseText(strings.NewReader("3 Volcanic Island {set=3ED}\n3 Volcanic Island\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	got := applyPrintings(nil, req, cards)
+
+	stock := func(key string) map[string]int {
+		s := make(map[string]int)
+		for _, cp := range got[key].Prices {
+			s[cp.Trader] += cp.Quantity
+		}
+		return s
+	}
+	if s := stock("Volcanic Island {set=3ED}"); !reflect.DeepEqual(s, map[string]int{"b": 2, "c": 1}) {
+		t.Errorf("the line with the printing should reserve the cheapest matching copies, got %v", s)
+	}
+	if s := stock("Volcanic Island"); !reflect.DeepEqual(s, map[string]int{"a": 2, "c": 2}) {
+		t.Errorf("the line without a printing should get the rest, got %v", s)
+	}
+}
+
+func TestParseTextKeepsPrintingsApart(t *testing.T) {
+	req, err := ParseText(strings.NewReader("3 Volcanic Island {set=3ED}\n1 Volcanic Island\n1 Volcanic Island {set=3ED}\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	want := map[string]int{"Volcanic Island {set=3ED}": 4, "Volcanic Island": 1}
+	if !reflect.DeepEqual(req.Cards, want) {
+		t.Errorf("expected cards %v, got %v", want, req.Cards)
+	}
+	if p := req.Printings["Volcanic Island {set=3ED}"]; p.Set != "3ED" {
+		t.Errorf("unexpected printing %+v", p)
+	}
+	if _, found := req.Printings["Volcanic Island"]; found {
+		t.Error("the line without a printing should not have one")
+	}
+	if len(req.Issues) != 1 || req.Issues[0].Line != 3 || req.Issues[0].Severity != SeverityWarning {
+		t.Errorf("a warning about the duplicated line 3 is expected, got %v", req.Issues)
+	}
+}
+
+func TestParseTextKeepsCollectorNumbers(t *testing.T) {
+	req, err := ParseText(strings.NewReader("2 Lightning Bolt {number=146}\n1 Lightning Bolt {set=M10 cn=147}\n"))
+	if err != nil {
+		t.Fatalf("could not parse the list: %s", err)
+	}
+	want := map[string]int{"Lightning Bolt": 2, "Lightning Bolt {set=M10}": 1}
+	if !reflect.DeepEqual(req.Cards, want) {
+		t.Errorf("collector numbers are expected to be left out of keys %v, got %v", want, req.Cards)
+	}
+	if n := req.Lines[0].CollectorNumber + "," + req.Lines[1].CollectorNumber; n != "146,147" {
+		t.Errorf("collector numbers are expected to be kept on lines, got %q", n)
+	}
+	if len(req.Issues) != 2 || req.Issues[0].Line != 1 || req.Issues[0].Severity != SeverityWarning {
+		t.Errorf("warnings about unmatched numbers are expected, got %v", req.Issues)
+	}
+}
@@ -0,0 +1,213 @@
+package mtgbulk
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files with actual results")
+
+func TestMain(m *testing.M) {
+	// parse failures are expected in fixtures, their stack traces only obscure the output
+	logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+var boltAliases = map[string]bool{
+	"lightning bolt": true,
+	"молния":         true,
+}
+
+var scraperCases = []struct {
+	golden string
+	// pages is a directory in testdata/scrapers with "<page>.html" files
+	pages  string
+	create func(SearcherOptions) Searcher
+	query  SearchQuery
+}{
+	{"mtgsale_english", "mtgsale", NewMtgSaleSearcher, SearchQuery{Name: "Lightning Bolt"}},
+	{"mtgsale_russian", "mtgsale", NewMtgSaleSearcher, SearchQuery{Name: "Молния"}},
+	{"mtgtrade_english", "mtgtrade", NewMtgTradeSearcher, SearchQuery{Name: "Lightning Bolt"}},
+	{"mtgtrade_russian", "mtgtrade", NewMtgTradeSearcher, SearchQuery{Name: "Молния"}},
+	{"spellmarket", "spellmarket", NewSpellMarketSearcher, SearchQuery{Name: "Молния", EnglishName: "Lightning Bolt", Aliases: boltAliases}},
+	{"autumnsmagic", "autumnsmagic", NewAutumnsMagicSearcher, SearchQuery{Name: "Молния", EnglishName: "Lightning Bolt", Aliases: boltAliases}},
+	{"topdeck_english", "topdeck", NewTopDeckSearcher, SearchQuery{Name: "Lightning Bolt"}},
+	{"topdeck_russian", "topdeck", NewTopDeckSearcher, SearchQuery{Name: "Молния"}},
+}
+
+// scraperGolden is what is compared against testdata/scrapers/<golden>.golden.json
+type scraperGolden struct {
+	Requests []string
+	Result   CardResult
+}
+
+// newPagesServer serves testdata/scrapers/<dir>/<page>.html, where page is taken from "page" query argument.
+func newPagesServer(t *testing.T, dir string, requests *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*requests = append(*requests, r.URL.RequestURI())
+		mu.Unlock()
+
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "scrapers", dir, page+".html"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(data)
+	}))
+}
+
+func TestScrapers(t *testing.T) {
+	for _, tc := range scraperCases {
+		tc := tc
+		t.Run(tc.golden, func(t *testing.T) {
+			var requests []string
+			srv := newPagesServer(t, tc.pages, &requests)
+			defer srv.Close()
+
+			s := tc.create(SearcherOptions{BaseURL: srv.URL})
+			res, err := s.Search(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("search failed: %s", err)
+			}
+
+			actual, err := json.MarshalIndent(scraperGolden{
+				Requests: requests,
+				Result:   res,
+			}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual = []byte(strings.ReplaceAll(string(actual), srv.URL, "BASE_URL"))
+
+			goldenPath := filepath.Join("testdata", "scrapers", tc.golden+".golden.json")
+			if *updateGolden {
+				if err := ioutil.WriteFile(goldenPath, actual, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("no golden file, run with -update to create it: %s", err)
+			}
+			if string(expected) != string(actual) {
+				t.Errorf("result differs from %s\nexpected:\n%s\nactual:\n%s", goldenPath, expected, actual)
+			}
+		})
+	}
+}
+
+func TestScraperReportsHTTPError(t *testing.T) {
+	var requests []string
+	srv := newPagesServer(t, "missing", &requests)
+	defer srv.Close()
+
+	s := NewMtgSaleSearcher(SearcherOptions{BaseURL: srv.URL})
+	res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	if err == nil {
+		t.Fatal("error is expected")
+	}
+	if len(res.Diagnostics) != 1 {
+		t.Fatalf("one diagnostics entry is expected, got %v", res.Diagnostics)
+	}
+	d := res.Diagnostics[0]
+	if d.Status != SearchFailed || d.HTTPCode != http.StatusNotFound {
+		t.Errorf("unexpected diagnostics %+v", d)
+	}
+}
+
+func TestScraperReportsFailedPage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "scrapers", "mtgtrade", "1.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	s := NewMtgTradeSearcher(SearcherOptions{BaseURL: srv.URL, HTTP: &HTTPPolicy{}})
+	res, err := s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	if err == nil {
+		t.Error("error is expected")
+	}
+	if len(res.Prices) == 0 {
+		t.Error("offers of the first page are expected")
+	}
+	d := res.Diagnostics[0]
+	if d.Status != SearchFailed || d.HTTPCode != http.StatusInternalServerError || d.Complete() {
+		t.Errorf("unexpected diagnostics %+v", d)
+	}
+}
+
+// newBlockingServer serves the first page of mtgtrade and blocks other pages until their requests are cancelled.
+// cancelled gets a value for every cancelled request
+func newBlockingServer(t *testing.T, cancelled chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			<-r.Context().Done()
+			cancelled <- r.URL.RequestURI()
+			return
+		}
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "scrapers", "mtgtrade", "1.html"))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestScraperStopsOnCancel(t *testing.T) {
+	cancelled := make(chan string, 1)
+	srv := newBlockingServer(t, cancelled)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	s := NewMtgTradeSearcher(SearcherOptions{BaseURL: srv.URL, HTTP: &HTTPPolicy{}})
+	start := time.Now()
+	res, err := s.Search(ctx, SearchQuery{Name: "Lightning Bolt"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the search is expected to stop on cancel, it took %s", elapsed)
+	}
+	if err == nil {
+		t.Error("error is expected")
+	}
+	if len(res.Prices) == 0 {
+		t.Error("offers of the first page are expected")
+	}
+	if len(res.Diagnostics) != 1 || res.Diagnostics[0].Complete() {
+		t.Errorf("incomplete diagnostics are expected, got %+v", res.Diagnostics)
+	}
+	select {
+	case uri := <-cancelled:
+		if !strings.Contains(uri, "page=2") {
+			t.Errorf("the request of the second page is expected to be cancelled, got %s", uri)
+		}
+	case <-time.After(time.Second):
+		t.Error("the request in flight is expected to be cancelled")
+	}
+}
@@ -0,0 +1,146 @@
+package mtgbulk
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	DefaultConcurrency       = 8
+	DefaultDomainConcurrency = 2
+)
+
+// DomainSearcher is implemented by searchers which know which domain they scrape.
+// Searchers which do not implement it are limited by their name instead.
+type DomainSearcher interface {
+	Domain() string
+}
+
+func searcherDomain(s Searcher) string {
+	if ds, ok := s.(DomainSearcher); ok {
+		if d := ds.Domain(); d != "" {
+			return d
+		}
+	}
+	return s.Name()
+}
+
+func (s *wrappedSearcher) Domain() string {
+	return searcherDomain(s.Searcher)
+}
+
+type searchTask struct {
+	cardIx, searcherIx int
+}
+
+type searchPool struct {
+	searchers         []Searcher
+	concurrency       int
+	domainConcurrency int
+
+	domainsMu sync.Mutex
+	domains   map[string]chan struct{}
+}
+
+func newSearchPool(searchers []Searcher, concurrency, domainConcurrency int) *searchPool {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	if domainConcurrency <= 0 {
+		domainConcurrency = DefaultDomainConcurrency
+	}
+	return &searchPool{
+		searchers:         searchers,
+		concurrency:       concurrency,
+		domainConcurrency: domainConcurrency,
+		domains:           make(map[string]chan struct{}),
+	}
+}
+
+func (p *searchPool) domainSlots(domain string) chan struct{} {
+	p.domainsMu.Lock()
+	defer p.domainsMu.Unlock()
+	slots, found := p.domains[domain]
+	if !found {
+		slots = make(chan struct{}, p.domainConcurrency)
+		p.domains[domain] = slots
+	}
+	return slots
+}
+
+// run searches every query at every searcher and returns merged results keyed by the card name.
+// If ctx is done, searches which have not started yet are skipped and the results are partial.
+// Prices inside each result are ordered by price; offers with equal price keep searcher registration order.
+func (p *searchPool) run(ctx context.Context, queries []SearchQuery) map[string]CardResult {
+	results := make([][]CardResult, len(queries))
+	for i := range results {
+		results[i] = make([]CardResult, len(p.searchers))
+		for j, s := range p.searchers {
+			results[i][j] = CardResult{
+				Diagnostics: []SearchDiagnostics{{
+					Platform: s.Name(),
+					Status:   SearchSkipped,
+				}},
+			}
+		}
+	}
+
+	tasks := make(chan searchTask)
+	var wg sync.WaitGroup
+	for i := 0; i < p.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				s := p.searchers[t.searcherIx]
+				q := queries[t.cardIx]
+				slots := p.domainSlots(searcherDomain(s))
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					continue
+				}
+				res, err := s.Search(ctx, q)
+				<-slots
+				if err != nil {
+					logger.Errorw("search failed",
+						"searcher", s.Name(),
+						"card", q.Name,
+						"err", err)
+				}
+				if len(res.Diagnostics) == 0 {
+					// custom searchers might know nothing about diagnostics
+					diag := newSearchDiagnostics(s.Name())
+					diag.RowsParsed = len(res.Prices)
+					diag.setError(err)
+					res.Diagnostics = []SearchDiagnostics{*diag}
+				}
+				results[t.cardIx][t.searcherIx] = res
+			}
+		}()
+	}
+
+feed:
+	for ci := range queries {
+		for si := range p.searchers {
+			select {
+			case tasks <- searchTask{cardIx: ci, searcherIx: si}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	merged := make(map[string]CardResult, len(queries))
+	for ci, q := range queries {
+		cardRes := newCardResult()
+		for _, res := range results[ci] {
+			cardRes.merge(res)
+		}
+		cardRes.sortByPrice()
+		merged[q.Name] = cardRes
+	}
+	return merged
+}
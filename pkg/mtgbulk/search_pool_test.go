@@ -0,0 +1,143 @@
+package mtgbulk
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyCounter remembers the max number of searches running at once, overall and per domain
+type concurrencyCounter struct {
+	mu                sync.Mutex
+	running, max      int
+	domainRunning     map[string]int
+	domainMax         map[string]int
+	searchesPerDomain map[string]int
+}
+
+func newConcurrencyCounter() *concurrencyCounter {
+	return &concurrencyCounter{
+		domainRunning:     make(map[string]int),
+		domainMax:         make(map[string]int),
+		searchesPerDomain: make(map[string]int),
+	}
+}
+
+func (c *concurrencyCounter) enter(domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running++
+	if c.running > c.max {
+		c.max = c.running
+	}
+	c.domainRunning[domain]++
+	if c.domainRunning[domain] > c.domainMax[domain] {
+		c.domainMax[domain] = c.domainRunning[domain]
+	}
+	c.searchesPerDomain[domain]++
+}
+
+func (c *concurrencyCounter) leave(domain string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	c.domainRunning[domain]--
+}
+
+// domainSearcher is a fakeSearcher scraping the given domain
+type domainSearcher struct {
+	fakeSearcher
+	domain string
+}
+
+func (s *domainSearcher) Domain() string { return s.domain }
+
+func countingSearcher(name, domain string, c *concurrencyCounter) Searcher {
+	return &domainSearcher{domain: domain, fakeSearcher: fakeSearcher{name: name, search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+		c.enter(domain)
+		defer c.leave(domain)
+		time.Sleep(5 * time.Millisecond)
+		return CardResult{Available: true, Prices: []CardPrice{{Trader: name, Price: 1, Quantity: 1}}}, nil
+	}}}
+}
+
+func TestSearchPoolLimitsConcurrency(t *testing.T) {
+	c := newConcurrencyCounter()
+	var searchers []Searcher
+	for _, s := range []struct{ name, domain string }{
+		{"a1", "a.example"}, {"a2", "a.example"}, {"a3", "a.example"},
+		{"b1", "b.example"}, {"b2", "b.example"},
+		{"c1", "c.example"},
+	} {
+		searchers = append(searchers, countingSearcher(s.name, s.domain, c))
+	}
+	var queries []SearchQuery
+	for i := 0; i < 20; i++ {
+		queries = append(queries, SearchQuery{Name: string(rune('A' + i))})
+	}
+
+	newSearchPool(searchers, 4, 2).run(context.Background(), queries)
+
+	if c.max > 4 {
+		t.Errorf("at most 4 searches are expected at once, got %d", c.max)
+	}
+	if c.max < 2 {
+		t.Errorf("searches are expected to run concurrently, got at most %d at once", c.max)
+	}
+	for domain, max := range c.domainMax {
+		if max > 2 {
+			t.Errorf("%s: at most 2 searches are expected at once, got %d", domain, max)
+		}
+	}
+	want := map[string]int{"a.example": 60, "b.example": 40, "c.example": 20}
+	if !reflect.DeepEqual(c.searchesPerDomain, want) {
+		t.Errorf("expected searches %v, got %v", want, c.searchesPerDomain)
+	}
+}
+
+func TestSearchPoolKeepsRegistrationOrder(t *testing.T) {
+	var searchers []Searcher
+	names := []string{"first", "second", "third", "fourth"}
+	for _, name := range names {
+		name := name
+		searchers = append(searchers, &fakeSearcher{name: name, search: func(ctx context.Context, q SearchQuery) (CardResult, error) {
+			// searchers finish in random order
+			time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+			return CardResult{Available: true, Prices: []CardPrice{
+				{Trader: name, Price: 2, Quantity: 1},
+				{Trader: name, Price: 1, Quantity: 1},
+			}}, nil
+		}})
+	}
+	queries := []SearchQuery{{Name: "Lightning Bolt"}, {Name: "Shock"}}
+
+	var want []string
+	for _, price := range []float32{1, 2} {
+		for _, name := range names {
+			want = append(want, name+" "+fmt.Sprint(price))
+		}
+	}
+	for i := 0; i < 10; i++ {
+		results := newSearchPool(searchers, 4, 1).run(context.Background(), queries)
+		for _, q := range queries {
+			var got []string
+			for _, cp := range results[q.Name].Prices {
+				got = append(got, cp.Trader+" "+fmt.Sprint(cp.Price))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: offers %v are expected, got %v", q.Name, want, got)
+			}
+			var platforms []string
+			for _, d := range results[q.Name].Diagnostics {
+				platforms = append(platforms, d.Platform)
+			}
+			if !reflect.DeepEqual(platforms, names) {
+				t.Fatalf("%s: diagnostics of %v are expected, got %v", q.Name, names, platforms)
+			}
+		}
+	}
+}
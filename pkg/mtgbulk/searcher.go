@@ -0,0 +1,256 @@
+package mtgbulk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// SearchQuery describes a single card lookup passed to a Searcher.
+type SearchQuery struct {
+	// Name is the card name exactly as it has been requested.
+	Name string
+	// EnglishName is the English name of the card.
+	EnglishName string
+	// Aliases contains all known lowercased names of the card (English, Russian, split halves).
+	Aliases map[string]bool
+}
+
+// Searcher looks up offers for a card at a single platform.
+type Searcher interface {
+	// Name is a unique name of the searcher used to enable/disable it in a Registry.
+	Name() string
+	// Platform is the platform all returned prices belong to.
+	Platform() PlatformType
+	// Search returns all offers of the card found at the platform.
+	Search(ctx context.Context, q SearchQuery) (CardResult, error)
+}
+
+// SearchFunc is the signature of Searcher.Search.
+type SearchFunc func(ctx context.Context, q SearchQuery) (CardResult, error)
+
+// Middleware wraps a Searcher with additional behaviour (caching, logging, etc.)
+type Middleware func(Searcher) Searcher
+
+type wrappedSearcher struct {
+	Searcher
+	search SearchFunc
+}
+
+func (s *wrappedSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q)
+}
+
+// WrapSearcher returns a Searcher which keeps name and platform of s but searches via fn.
+func WrapSearcher(s Searcher, fn SearchFunc) Searcher {
+	return &wrappedSearcher{
+		Searcher: s,
+		search:   fn,
+	}
+}
+
+// SearcherOptions configures a built-in searcher.
+type SearcherOptions struct {
+	// BaseURL replaces scheme and host of the production site, e.g. "http://localhost:8080"
+	BaseURL string
+	// Transport is used for all requests of the searcher. A transport using the policy proxy is created if nil
+	Transport http.RoundTripper
+	// HTTP is applied on top of Transport. DefaultHTTPPolicy is used if nil
+	HTTP *HTTPPolicy
+}
+
+// platformSearcher contains everything built-in searchers have in common.
+type platformSearcher struct {
+	platform  PlatformType
+	baseURL   string
+	transport http.RoundTripper
+}
+
+func newPlatformSearcher(platform PlatformType, defaultBaseURL string, opts SearcherOptions) platformSearcher {
+	baseURL := defaultBaseURL
+	if opts.BaseURL != "" {
+		baseURL = opts.BaseURL
+	}
+	policy := DefaultHTTPPolicy
+	if opts.HTTP != nil {
+		policy = *opts.HTTP
+	}
+	base := opts.Transport
+	if base == nil {
+		base = policy.baseTransport()
+	}
+	return platformSearcher{
+		platform: platform,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		transport: &policyTransport{
+			policy: policy,
+			base:   base,
+		},
+	}
+}
+
+func (s *platformSearcher) Name() string {
+	return s.platform.String()
+}
+
+func (s *platformSearcher) Platform() PlatformType {
+	return s.platform
+}
+
+func (s *platformSearcher) BaseURL() string {
+	return s.baseURL
+}
+
+func (s *platformSearcher) Domain() string {
+	u, err := url.Parse(s.baseURL)
+	if err != nil {
+		return s.baseURL
+	}
+	return u.Host
+}
+
+// Registry holds the set of searchers used by ProcessByNames.
+type Registry struct {
+	mu         sync.RWMutex
+	searchers  []Searcher
+	disabled   map[string]bool
+	middleware []Middleware
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		searchers: make([]Searcher, 0),
+		disabled:  make(map[string]bool),
+	}
+}
+
+// NewDefaultRegistry returns a registry with all built-in platforms registered and enabled.
+func NewDefaultRegistry() *Registry {
+	r, err := NewConfiguredRegistry(Config{})
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// DefaultRegistry is used by requests which do not specify their own registry.
+var DefaultRegistry = NewDefaultRegistry()
+
+// Register adds a searcher. Searchers are queried in the order of registration.
+func (r *Registry) Register(s Searcher) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.searchers {
+		if existing.Name() == s.Name() {
+			return fmt.Errorf("searcher %q is already registered", s.Name())
+		}
+	}
+	r.searchers = append(r.searchers, s)
+	return nil
+}
+
+func (r *Registry) Enable(name string) error {
+	return r.setEnabled(name, true)
+}
+
+func (r *Registry) Disable(name string) error {
+	return r.setEnabled(name, false)
+}
+
+func (r *Registry) setEnabled(name string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.searchers {
+		if s.Name() == name {
+			if enabled {
+				delete(r.disabled, name)
+			} else {
+				r.disabled[name] = true
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("searcher %q is not registered", name)
+}
+
+// Use appends middleware applied to every searcher. The first added middleware is the outermost one.
+func (r *Registry) Use(mw ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Clone returns a registry with the same searchers, enabled state and middleware.
+// Changes of the clone do not affect r, e.g. of DefaultRegistry shared by the whole process.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	clone.searchers = append(clone.searchers, r.searchers...)
+	clone.middleware = append(clone.middleware, r.middleware...)
+	for name := range r.disabled {
+		clone.disabled[name] = true
+	}
+	return clone
+}
+
+// Names returns names of all registered searchers, including disabled ones.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.searchers))
+	for _, s := range r.searchers {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// Searchers returns all enabled searchers wrapped with the registered middleware.
+func (r *Registry) Searchers() []Searcher {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]Searcher, 0, len(r.searchers))
+	for _, s := range r.searchers {
+		if r.disabled[s.Name()] {
+			continue
+		}
+		for i := len(r.middleware) - 1; i >= 0; i-- {
+			s = r.middleware[i](s)
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// Only returns a registry with the same searchers and middleware where only the named searchers are enabled.
+// Every name has to be registered and enabled in r.
+func (r *Registry) Only(names []string) (*Registry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		found := false
+		for _, s := range r.searchers {
+			if s.Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found || r.disabled[name] {
+			return nil, fmt.Errorf("searcher %q is not enabled", name)
+		}
+		wanted[name] = true
+	}
+	only := NewRegistry()
+	only.searchers = append(only.searchers, r.searchers...)
+	only.middleware = append(only.middleware, r.middleware...)
+	for _, s := range r.searchers {
+		if !wanted[s.Name()] {
+			only.disabled[s.Name()] = true
+		}
+	}
+	return only, nil
+}
@@ -0,0 +1,39 @@
+package mtgbulk
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRegistryCloneKeepsOriginal(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register(offersSearcher("a", nil))
+	registry.Register(offersSearcher("b", nil))
+	registry.Disable("b")
+
+	var wrapped int
+	clone := registry.Clone()
+	clone.Use(func(s Searcher) Searcher {
+		return WrapSearcher(s, func(ctx context.Context, q SearchQuery) (CardResult, error) {
+			wrapped++
+			return s.Search(ctx, q)
+		})
+	})
+	clone.Enable("b")
+
+	for _, s := range registry.Searchers() {
+		s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	}
+	if wrapped != 0 {
+		t.Errorf("middleware of the clone is applied to the original registry")
+	}
+	if n := len(registry.Searchers()); n != 1 {
+		t.Errorf("1 enabled searcher is expected in the original registry, got %d", n)
+	}
+	for _, s := range clone.Searchers() {
+		s.Search(context.Background(), SearchQuery{Name: "Lightning Bolt"})
+	}
+	if wrapped != 2 {
+		t.Errorf("middleware is expected to wrap both searchers of the clone, got %d searches", wrapped)
+	}
+}
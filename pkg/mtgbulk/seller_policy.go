@@ -0,0 +1,120 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SellerPolicy tells which sellers can be bought from and how much they are preferred.
+// Sellers are named as SellerFullName does, e.g. "mtgsale" or "trader@TopDeck", case is ignored.
+type SellerPolicy struct {
+	// Blocked sellers are never bought from
+	Blocked []string `json:"blocked"`
+	// Allowed limits sellers to the listed ones if not empty
+	Allowed []string `json:"allowed"`
+	// Preferences change prices of sellers when offers are compared. Actual prices are reported as is.
+	// Validate normalizes seller names of preferences
+	Preferences map[string]SellerPreference `json:"preferences"`
+}
+
+// SellerPreference makes a price of every copy compared as Price * Multiplier + Penalty.
+// A multiplier below 1 or a negative penalty makes the seller preferred.
+type SellerPreference struct {
+	// Multiplier of 0 is the same as 1
+	Multiplier float32 `json:"multiplier"`
+	Penalty    float32 `json:"penalty"`
+}
+
+func normalizeSeller(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (p *SellerPolicy) Validate() error {
+	normalized := make(map[string]SellerPreference, len(p.Preferences))
+	renamed := false
+	for name, pref := range p.Preferences {
+		if pref.Multiplier < 0 {
+			return fmt.Errorf("seller %q: multiplier cannot be negative: %v", name, pref.Multiplier)
+		}
+		seller := normalizeSeller(name)
+		if _, found := normalized[seller]; found {
+			return fmt.Errorf("seller %q has several preferences", seller)
+		}
+		normalized[seller] = pref
+		renamed = renamed || seller != name
+	}
+	// a policy of the config is shared by requests, so it is written only once
+	if renamed {
+		p.Preferences = normalized
+	}
+	return nil
+}
+
+func (p *SellerPolicy) permits(cp CardPrice) bool {
+	if p == nil {
+		return true
+	}
+	seller := normalizeSeller(cp.SellerFullName())
+	for _, name := range p.Blocked {
+		if normalizeSeller(name) == seller {
+			return false
+		}
+	}
+	if len(p.Allowed) == 0 {
+		return true
+	}
+	for _, name := range p.Allowed {
+		if normalizeSeller(name) == seller {
+			return true
+		}
+	}
+	return false
+}
+
+// price is the price of the offer as it is compared to others.
+func (p *SellerPolicy) price(cp CardPrice) float32 {
+	return p.weigh(cp.SellerFullName(), cp.Price)
+}
+
+func (p *SellerPolicy) weigh(seller string, price float32) float32 {
+	if p == nil {
+		return price
+	}
+	pref, found := p.Preferences[normalizeSeller(seller)]
+	if !found {
+		return price
+	}
+	if pref.Multiplier > 0 {
+		price *= pref.Multiplier
+	}
+	price += pref.Penalty
+	if price < 0 {
+		price = 0
+	}
+	return price
+}
+
+// apply drops offers of sellers which are not permitted and sorts the rest by compared price.
+// A card is not available if no offers are left.
+func (p *SellerPolicy) apply(cards map[string]CardResult) map[string]CardResult {
+	if p == nil {
+		return cards
+	}
+	result := make(map[string]CardResult, len(cards))
+	for name, res := range cards {
+		filtered := res
+		filtered.Prices = nil
+		for _, cp := range res.Prices {
+			if p.permits(cp) {
+				filtered.Prices = append(filtered.Prices, cp)
+			}
+		}
+		sort.SliceStable(filtered.Prices, func(i, j int) bool {
+			return p.price(filtered.Prices[i]) < p.price(filtered.Prices[j])
+		})
+		filtered.Available = res.Available && len(filtered.Prices) > 0
+		result[name] = filtered
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package mtgbulk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSellerPolicyReportsActualPrices(t *testing.T) {
+	sellers := &SellerPolicy{
+		Blocked:     []string{"c@MtgTrade"},
+		Preferences: map[string]SellerPreference{"A@mtgtrade": {Multiplier: 2, Penalty: 1}},
+	}
+	if err := sellers.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cards := sellers.apply(testCards(map[string][]testOffer{
+		"Lightning Bolt": {{"a", 10, 1}, {"b", 15, 1}, {"c", 5, 1}},
+	}))
+	var traders []string
+	for _, cp := range cards["Lightning Bolt"].Prices {
+		traders = append(traders, cp.Trader)
+	}
+	if want := []string{"b", "a"}; !reflect.DeepEqual(traders, want) {
+		t.Errorf("offers of %v are expected by weighted price, got %v", want, traders)
+	}
+
+	m := fillMinPricesMatrix(cards, sellers)
+	want := map[string]int{testSeller("a"): 10, testSeller("b"): 15}
+	if got := m.CardSellers["Lightning Bolt"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("actual prices %v are expected in the matrix, got %v", want, got)
+	}
+	if got, want := NewPossessionTable(m).Sellers, []string{testSeller("b"), testSeller("a")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sellers %v are expected in the matrix by weighted totals, got %v", want, got)
+	}
+}
+
+func TestSellerPolicyRejectsDuplicatePreferences(t *testing.T) {
+	sellers := &SellerPolicy{Preferences: map[string]SellerPreference{
+		"a@MtgTrade": {Multiplier: 2},
+		"A@mtgtrade": {Penalty: 10},
+	}}
+	if err := sellers.Validate(); err == nil {
+		t.Error("preferences of the same seller in different cases are expected to be rejected")
+	}
+}
@@ -1,6 +1,7 @@
 package mtgbulk
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -10,69 +11,96 @@ import (
 	"github.com/gocolly/colly"
 )
 
-func searchSpellMarket(searchName string, names map[string]bool) CardResult {
+const spellMarketBaseURL = "https://spellmarket.ru"
+
+type spellMarketSearcher struct {
+	platformSearcher
+}
+
+func NewSpellMarketSearcher(opts SearcherOptions) Searcher {
+	return &spellMarketSearcher{
+		platformSearcher: newPlatformSearcher(SpellMarket, spellMarketBaseURL, opts),
+	}
+}
+
+func (s *spellMarketSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q.Name, q.Aliases)
+}
+
+func (s *spellMarketSearcher) search(ctx context.Context, searchName string, names map[string]bool) (CardResult, error) {
 	result := newCardResult()
-	addr := spellMarketSearchURL(searchName)
-	c := colly.NewCollector()
+	addr := spellMarketSearchURL(s.baseURL, searchName)
+	c := newCollector(ctx, s.transport)
+	diag := newSearchDiagnostics(SpellMarket.String())
+	diag.trackResponses(c)
 
 	currency1 := &http.Cookie{Name: "currency", Value: "RUB"}
 	currency2 := &http.Cookie{Name: "prmn_currency", Value: "RUB"}
 	c.SetCookies(addr, []*http.Cookie{currency1, currency2})
 
 	c.OnHTML("div.product-wrapper", func(e *colly.HTMLElement) {
-		if strings.Contains(e.Attr("class"), "outofstock") {
-			return
-		}
-
-		name := strings.ToLower(e.ChildText(".name"))
-		if !names[name] {
-			return
-		}
-
-		pStr := e.ChildText(".price")
-		pStr = strings.ReplaceAll(pStr, " р.", "")
-		price, err := strconv.ParseFloat(pStr, 32)
+		price, matched, err := parseSpellMarketItem(e, names)
 		if err != nil {
-			logger.Errorw("card price convert failed",
+			logger.Errorw("spellmarket item cannot be parsed",
+				"searchName", searchName,
 				"err", err)
+			diag.RowsSkipped++
 			return
 		}
-
-		qty, err := strconv.Atoi(e.ChildText(".quantity span"))
-		if err != nil {
-			logger.Errorw("card qty convert failed",
-				"err", err)
+		if !matched {
 			return
 		}
 
 		logger.Debugw("card found",
 			"searchName", searchName,
-			"name", name,
-			"price", price,
-			"qty", qty)
+			"price", price.Price,
+			"qty", price.Quantity)
 
+		diag.RowsParsed++
+		price.URL = addr // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
 		result.Available = true
-		result.Prices = append(result.Prices, CardPrice{
-			Price:    float32(price),
-			Foil:     false, // TODO
-			Currency: RUR,
-			Quantity: qty,
-			Platform: SpellMarket,
-			Trader:   "spellmarket",
-			URL:      addr, // TODO: correct it! - it's just a search result, but we can get a direct link to a card at a seller
-		})
+		result.Prices = append(result.Prices, price)
 	})
 
 	err := c.Visit(addr)
+	return finishSearch(ctx, result, diag, addr, err)
+}
+
+func spellMarketSearchURL(baseURL, searchName string) string {
+	return fmt.Sprintf("%s/search?search=%s%s", baseURL, url.PathEscape(searchName), url.PathEscape("&limit=1000"))
+}
+
+// parseSpellMarketItem parses a single product. matched is false if the product is another card or is out of stock.
+func parseSpellMarketItem(e *colly.HTMLElement, names map[string]bool) (price CardPrice, matched bool, err error) {
+	if strings.Contains(e.Attr("class"), "outofstock") {
+		return price, false, nil
+	}
+
+	title := e.ChildText(".name")
+	name := strings.ToLower(title)
+	if !names[name] {
+		return price, false, nil
+	}
+
+	pStr := e.ChildText(".price")
+	pStr = strings.ReplaceAll(pStr, " р.", "")
+	pVal, err := strconv.ParseFloat(pStr, 32)
 	if err != nil {
-		logger.Errorw("Unable to visit with scraper",
-			"url", addr,
-			"err", err)
+		return price, true, fmt.Errorf("card price convert failed: %w", err)
 	}
 
-	return result
-}
+	qty, err := strconv.Atoi(e.ChildText(".quantity span"))
+	if err != nil {
+		return price, true, fmt.Errorf("card qty convert failed: %w", err)
+	}
 
-func spellMarketSearchURL(searchName string) string {
-	return fmt.Sprintf("https://spellmarket.ru/search?search=%s%s", url.PathEscape(searchName), url.PathEscape("&limit=1000"))
+	return CardPrice{
+		Price:       float32(pVal),
+		FoilUnknown: true, // products do not tell foil copies apart
+		Currency:    RUR,
+		Quantity:    qty,
+		Language:    nameLanguage(title), // guessed by the script of the title
+		Platform:    SpellMarket,
+		Trader:      "spellmarket",
+	}, true, nil
 }
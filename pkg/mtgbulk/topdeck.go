@@ -1,6 +1,7 @@
 package mtgbulk
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -22,103 +23,135 @@ type topdeckCard struct {
 	Qty    int    `json:"qty"`
 	Cost   int    `json:"cost"`
 	Source string `json:"source"`
+	// Set and Lang are empty if the seller has not told them
+	Set  string `json:"set"`
+	Lang string `json:"lang"`
 }
 
-func searchTopDeck(cardname string) CardResult {
+const topDeckBaseURL = "https://topdeck.ru"
+
+type topDeckSearcher struct {
+	platformSearcher
+}
+
+func NewTopDeckSearcher(opts SearcherOptions) Searcher {
+	return &topDeckSearcher{
+		platformSearcher: newPlatformSearcher(TopDeck, topDeckBaseURL, opts),
+	}
+}
+
+func (s *topDeckSearcher) Search(ctx context.Context, q SearchQuery) (CardResult, error) {
+	return s.search(ctx, q.Name)
+}
+
+func (s *topDeckSearcher) search(ctx context.Context, cardname string) (CardResult, error) {
 	cardname = strings.ToLower(cardname)
 	result := newCardResult()
-	addr := topDeckSearchURL(cardname)
+	addr := topDeckSearchURL(s.baseURL, cardname)
 
-	c := colly.NewCollector()
+	c := newCollector(ctx, s.transport)
+	diag := newSearchDiagnostics(TopDeck.String())
+	diag.trackResponses(c)
 
 	c.OnHTML("script", func(e *colly.HTMLElement) {
-		matches := re.FindAllSubmatch([]byte(e.Text), -1)
-		if len(matches) == 0 {
-			return
-		}
-		text := matches[0][1]
-		pos := 0
-		finalTxt := ""
-		for pos < len(text) {
-			if text[pos] == '\\' && text[pos+1] == 'u' {
-				s := fmt.Sprintf("'%s'", text[pos:pos+6])
-				c, err := strconv.Unquote(s)
-				if err != nil {
-					logger.Errorw("Unquote failed",
-						"err", err)
-					return
-				}
-				finalTxt = finalTxt + c
-				pos += 6
-			} else {
-				finalTxt = finalTxt + string(text[pos])
-				pos++
-			}
+		prices, skipped := parseTopDeckScript(e.Text, cardname)
+		diag.RowsSkipped += skipped
+		diag.RowsParsed += len(prices)
+		if len(prices) > 0 {
+			result.Available = true
+			result.Prices = append(result.Prices, prices...)
 		}
-		finalTxt = strings.ReplaceAll(finalTxt, "\\\"", "")
-		finalTxt = strings.ReplaceAll(finalTxt, "\\", "")
-		//fmt.Printf("RESULT %s\n", finalTxt)
+	})
 
-		dec := json.NewDecoder(strings.NewReader(finalTxt))
-		_, err := dec.Token()
-		if err != nil {
-			logger.Errorw("get opening failed",
-				"err", err)
-			return
-		}
-		for dec.More() {
-			var c topdeckCard
-			err := dec.Decode(&c)
-			if c.Source != "topdeck" {
-				// some other shop like spellmarket or mtgsale
-				continue
-			}
+	err := c.Visit(addr)
+	return finishSearch(ctx, result, diag, addr, err)
+}
+
+func topDeckSearchURL(baseURL, cardname string) string {
+	cardname = strings.ReplaceAll(cardname, " ", "+")
+	return fmt.Sprintf("%s/apps/toptrade/singles/search?q=%s", baseURL, cardname)
+}
+
+// parseTopDeckScript extracts offers of cardname from the JSON embedded into a page script.
+// skipped is the number of offers which could not be parsed.
+func parseTopDeckScript(script, cardname string) (prices []CardPrice, skipped int) {
+	matches := re.FindAllSubmatch([]byte(script), -1)
+	if len(matches) == 0 {
+		return prices, skipped
+	}
+	text := matches[0][1]
+	pos := 0
+	finalTxt := ""
+	for pos < len(text) {
+		if text[pos] == '\\' && text[pos+1] == 'u' {
+			s := fmt.Sprintf("'%s'", text[pos:pos+6])
+			c, err := strconv.Unquote(s)
 			if err != nil {
-				logger.Errorw("decode failed",
+				logger.Errorw("Unquote failed",
 					"err", err)
-				continue
-			}
-			if strings.ToLower(c.RusName) != cardname && strings.ToLower(c.EngName) != cardname {
-				continue
+				skipped++
+				return prices, skipped
 			}
-
-			logger.Debugw("card found",
-				"cardname", cardname,
-				"ru_name", c.RusName,
-				"en_name", c.EngName,
-				"cost", c.Cost,
-				"qty", c.Qty)
-
-			result.Available = true
-			result.Prices = append(result.Prices, CardPrice{
-				Price:    float32(c.Cost),
-				Foil:     false,
-				Currency: RUR,
-				Quantity: c.Qty,
-				Platform: TopDeck,
-				Trader:   c.Seller.Name,
-				URL:      c.URL,
-			})
+			finalTxt = finalTxt + c
+			pos += 6
+		} else {
+			finalTxt = finalTxt + string(text[pos])
+			pos++
 		}
-		_, err = dec.Token()
+	}
+	finalTxt = strings.ReplaceAll(finalTxt, "\\\"", "")
+	finalTxt = strings.ReplaceAll(finalTxt, "\\", "")
+	//fmt.Printf("RESULT %s\n", finalTxt)
+
+	dec := json.NewDecoder(strings.NewReader(finalTxt))
+	_, err := dec.Token()
+	if err != nil {
+		logger.Errorw("get opening failed",
+			"err", err)
+		skipped++
+		return prices, skipped
+	}
+	for dec.More() {
+		var c topdeckCard
+		err := dec.Decode(&c)
 		if err != nil {
-			logger.Errorw("read closing failed",
+			// the decoder cannot recover from malformed input, so the rest of the list is lost
+			logger.Errorw("decode failed",
 				"err", err)
-			return
+			skipped++
+			return prices, skipped
+		}
+		if c.Source != "topdeck" {
+			// some other shop like spellmarket or mtgsale
+			continue
+		}
+		if strings.ToLower(c.RusName) != cardname && strings.ToLower(c.EngName) != cardname {
+			continue
 		}
-	})
 
-	err := c.Visit(addr)
+		logger.Debugw("card found",
+			"cardname", cardname,
+			"ru_name", c.RusName,
+			"en_name", c.EngName,
+			"cost", c.Cost,
+			"qty", c.Qty)
+
+		prices = append(prices, CardPrice{
+			Price:       float32(c.Cost),
+			FoilUnknown: true, // offers do not tell foil copies apart
+			Currency:    RUR,
+			Quantity:    c.Qty,
+			Edition:     strings.TrimSpace(c.Set),
+			Language:    strings.ToLower(strings.TrimSpace(c.Lang)),
+			Platform:    TopDeck,
+			Trader:      c.Seller.Name,
+			URL:         c.URL,
+		})
+	}
+	_, err = dec.Token()
 	if err != nil {
-		logger.Errorw("Unable to scrape",
-			"url", addr,
+		logger.Errorw("read closing failed",
 			"err", err)
 	}
-
-	return result
-}
-
-func topDeckSearchURL(cardname string) string {
-	cardname = strings.ReplaceAll(cardname, " ", "+")
-	return fmt.Sprintf("https://topdeck.ru/apps/toptrade/singles/search?q=%s", cardname)
+	return prices, skipped
 }
@@ -0,0 +1,132 @@
+package mtgbulk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity tells whether a problem of a list line prevents it from being processed.
+type Severity string
+
+const (
+	// SeverityWarning is a problem which has been fixed, e.g. duplicated lines have been merged
+	SeverityWarning Severity = "warning"
+	// SeverityError is a line which cannot be processed
+	SeverityError Severity = "error"
+)
+
+// Issue is a problem found in a list.
+type Issue struct {
+	// Line is the number of the line starting from 1, 0 if the problem is not bound to a line
+	Line     int
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", i.Line, i.Severity, i.Message)
+}
+
+// ValidationMode chooses what happens to lines with errors.
+type ValidationMode string
+
+const (
+	// ValidationStrict rejects the whole list if any line has an error
+	ValidationStrict ValidationMode = ""
+	// ValidationLenient skips lines with errors and processes the rest
+	ValidationLenient ValidationMode = "lenient"
+)
+
+// ParseValidationMode accepts "strict", "lenient" or an empty string for ValidationStrict.
+func ParseValidationMode(s string) (ValidationMode, error) {
+	switch strings.ToLower(s) {
+	case "", "strict":
+		return ValidationStrict, nil
+	case string(ValidationLenient):
+		return ValidationLenient, nil
+	}
+	return "", fmt.Errorf("unknown validation mode %q", s)
+}
+
+// ValidationError is returned if a list cannot be processed, it lists every problem found.
+type ValidationError struct {
+	Issues []Issue
+}
+
+func (e *ValidationError) Error() string {
+	var errs []string
+	for _, i := range e.Issues {
+		if i.Severity == SeverityError {
+			errs = append(errs, i.String())
+		}
+	}
+	return fmt.Sprintf("%d problems in the list: %s", len(errs), strings.Join(errs, "; "))
+}
+
+func (req *NamesRequest) issue(line int, severity Severity, format string, args ...interface{}) {
+	i := Issue{Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	logger.Warnw("list issue",
+		"issue", i.String())
+	req.Issues = append(req.Issues, i)
+}
+
+// validate finishes parsing: lines with errors have been skipped, strict mode rejects the list if there were any.
+func (req NamesRequest) validate(mode ValidationMode) (NamesRequest, error) {
+	if len(req.Cards) == 0 {
+		req.issue(0, SeverityError, "empty card list")
+	}
+	for _, i := range req.Issues {
+		if i.Severity != SeverityError {
+			continue
+		}
+		if mode == ValidationStrict || len(req.Cards) == 0 {
+			return req, &ValidationError{Issues: req.Issues}
+		}
+	}
+	return req, nil
+}
+
+// OptionsError is returned by ProcessByNamesContext if options of the request are invalid, nothing is searched then.
+type OptionsError struct {
+	Err error
+}
+
+func (e *OptionsError) Error() string {
+	return "invalid request options: " + e.Err.Error()
+}
+
+func (e *OptionsError) Unwrap() error {
+	return e.Err
+}
+
+func (req *NamesRequest) validateOptions() error {
+	if req.Delivery != nil {
+		if err := req.Delivery.Validate(); err != nil {
+			return err
+		}
+	}
+	if req.Sellers != nil {
+		if err := req.Sellers.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := req.Strategy.validate(); err != nil {
+		return err
+	}
+	if req.MaxSellers < 0 {
+		return fmt.Errorf("max sellers cannot be negative: %d", req.MaxSellers)
+	}
+	if req.Budget < 0 {
+		return fmt.Errorf("budget cannot be negative: %v", req.Budget)
+	}
+	if req.Alternatives < 0 {
+		return fmt.Errorf("number of alternatives cannot be negative: %d", req.Alternatives)
+	}
+	if err := req.Split.validate(); err != nil {
+		return err
+	}
+	return nil
+}
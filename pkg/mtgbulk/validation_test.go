@@ -0,0 +1,84 @@
+package mtgbulk
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testList has a duplicate at lines 2 and 9 (line 8 is of another owner) and errors at lines 3, 6 and 10
+const testList = `4 Lightning Bolt
+Lightning Bolt
+0 Counterspell
+
+2 Shock [must]
+3 Shock [maybe]
+1 Counterspell @alice
+1 Counterspell @bob
+1 Counterspell @alice
+1 Volcanic Island {frame=old}
+`
+
+func TestParseTextModeIssues(t *testing.T) {
+	want := []Issue{
+		{Line: 2, Severity: SeverityWarning},
+		{Line: 3, Severity: SeverityError},
+		{Line: 6, Severity: SeverityError},
+		{Line: 9, Severity: SeverityWarning},
+		{Line: 10, Severity: SeverityError},
+	}
+	for _, mode := range []ValidationMode{ValidationStrict, ValidationLenient} {
+		req, err := ParseTextMode(strings.NewReader(testList), mode)
+		got := make([]Issue, 0, len(req.Issues))
+		for _, i := range req.Issues {
+			if i.Message == "" {
+				t.Errorf("%q: issue without a message at line %d", mode, i.Line)
+			}
+			got = append(got, Issue{Line: i.Line, Severity: i.Severity})
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected issues %v, got %v", mode, want, got)
+		}
+
+		var validationErr *ValidationError
+		if mode == ValidationStrict {
+			if !errors.As(err, &validationErr) || !reflect.DeepEqual(validationErr.Issues, req.Issues) {
+				t.Errorf("%q: ValidationError with every issue is expected, got %v", mode, err)
+			}
+			if msg := err.Error(); !strings.HasPrefix(msg, "3 problems") || !strings.Contains(msg, "line 6:") || strings.Contains(msg, "line 2:") {
+				t.Errorf("%q: errors only are expected in the message, got %q", mode, msg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", mode, err)
+		}
+		// lines with errors are skipped, duplicates are merged
+		wantCards := map[string]int{"Lightning Bolt": 5, "Shock": 2, "Counterspell": 3}
+		if !reflect.DeepEqual(req.Cards, wantCards) {
+			t.Errorf("%q: expected cards %v, got %v", mode, wantCards, req.Cards)
+		}
+		wantOwners := map[string]map[string]int{"Counterspell": {"alice": 2, "bob": 1}}
+		if !reflect.DeepEqual(req.Owners, wantOwners) {
+			t.Errorf("%q: expected owners %v, got %v", mode, wantOwners, req.Owners)
+		}
+	}
+}
+
+func TestParseTextModeRejectsEmptyList(t *testing.T) {
+	for _, list := range []string{"", "\n  \n", "0 Lightning Bolt\n"} {
+		for _, mode := range []ValidationMode{ValidationStrict, ValidationLenient} {
+			req, err := ParseTextMode(strings.NewReader(list), mode)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Errorf("%q, %q: ValidationError is expected, got %v", list, mode, err)
+				continue
+			}
+			last := req.Issues[len(req.Issues)-1]
+			if last.Line != 0 || last.Severity != SeverityError || last.Message != "empty card list" {
+				t.Errorf("%q, %q: the empty list is expected to be reported, got %v", list, mode, req.Issues)
+			}
+		}
+	}
+}